@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+)
+
+//Backends for -backend, the API threads are fetched from
+const (
+	backendFirebase = "firebase"
+	backendAlgolia  = "algolia"
+)
+
+//The Algolia HN API returns an item with all of its descendants in a single response
+//https://hn.algolia.com/api
+const algoliaURLToFormat = "https://hn.algolia.com/api/v1/items/%d"
+
+func validateBackend(backend string) error {
+	switch backend {
+	case backendFirebase, backendAlgolia:
+		return nil
+	}
+	return fmt.Errorf("unknown backend %q, expected firebase or algolia", backend)
+}
+
+type algoliaItem struct {
+	ID       int64         `json:"id"`
+	Author   string        `json:"author"`
+	Text     string        `json:"text"`
+	ParentID int64         `json:"parent_id"`
+	Time     int64         `json:"created_at_i"`
+	Children []algoliaItem `json:"children"`
+}
+
+//Fetches the comments of a thread with one request instead of one per comment, as deep and as
+//broad as options.depth and options.maxChildren allow. The onComment callbacks and comment cache
+//in options are applied, there are no raw responses or per comment failures to report
+func fetchFromAlgolia(ctx context.Context, threadID int64, options fetchOptions) ([]hnComment, error) {
+	url := fmt.Sprintf(algoliaURLToFormat, threadID)
+	var thread algoliaItem
+	if _, err := fetchObject(ctx, url, &thread); err != nil {
+		return nil, err
+	}
+
+	//Like fetchFromAPI, level by level and all top level comments
+	var comments []hnComment
+	level := thread.Children
+	for depth := 1; len(level) > 0; depth++ {
+		var next []algoliaItem
+		for _, child := range level {
+			c := hnComment{
+				By:     child.Author,
+				ID:     child.ID,
+				Parent: child.ParentID,
+				Text:   html.UnescapeString(child.Text),
+				Time:   child.Time,
+			}
+			for _, kid := range child.Children {
+				c.Kids = append(c.Kids, kid.ID)
+			}
+			if options.cache != nil {
+				options.cache.put(c)
+			}
+			if options.onComment != nil {
+				options.onComment(c)
+			}
+			comments = append(comments, c)
+
+			children := child.Children
+			if options.maxChildren > 0 && len(children) > options.maxChildren {
+				children = children[:options.maxChildren]
+			}
+			next = append(next, children...)
+		}
+		if options.depth > 0 && depth >= options.depth {
+			break
+		}
+		level = next
+	}
+	markOP(comments, thread.Author)
+	return comments, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"html"
+	"log"
+	"sync"
+)
+
+//A comment that a fetched comment replies to, directly or further up the thread
+type ancestor struct {
+	ID   int64  `json:"id"`
+	By   string `json:"by"`
+	Text string `json:"text"`
+}
+
+//The fields of an item needed to walk up a thread
+type hnItem struct {
+	By     string `json:"by"`
+	ID     int64  `json:"id"`
+	Parent int64  `json:"parent"`
+	Text   string `json:"text"`
+	Type   string `json:"type"`
+}
+
+//Sets the Ancestors of every comment to up to depth of the comments it replies to, closest first.
+//The walk stops at the story. Items are fetched one level at a time for all comments at once and
+//each item is only fetched once. Items that fail to fetch end the walk for the comments that need
+//them and parent cycles are cut off. Parents are read from and added to cache unless it's nil
+func attachAncestors(ctx context.Context, comments []hnComment, depth int, cache *commentCache) {
+	//Comments that reply to each other don't need to be fetched again
+	items := make(map[int64]*hnItem)
+	for _, c := range comments {
+		items[c.ID] = &hnItem{By: c.By, ID: c.ID, Parent: c.Parent, Text: c.Text, Type: "comment"}
+	}
+	next := make([]int64, len(comments))
+	visited := make([]map[int64]bool, len(comments))
+	for i, c := range comments {
+		next[i] = c.Parent
+		visited[i] = map[int64]bool{c.ID: true}
+		comments[i].Ancestors = nil
+	}
+
+	for level := 0; level < depth; level++ {
+		var missing []int64
+		for _, id := range next {
+			if _, ok := items[id]; id != 0 && !ok {
+				items[id] = nil
+				missing = append(missing, id)
+			}
+		}
+		for id, item := range fetchItems(ctx, missing, cache) {
+			items[id] = item
+		}
+
+		done := true
+		for i := range comments {
+			item := items[next[i]]
+			if next[i] == 0 || item == nil || item.Type != "comment" || visited[i][item.ID] {
+				next[i] = 0
+				continue
+			}
+			visited[i][item.ID] = true
+			comments[i].Ancestors = append(comments[i].Ancestors, ancestor{ID: item.ID, By: item.By, Text: item.Text})
+			next[i] = item.Parent
+			done = false
+		}
+		if done {
+			return
+		}
+	}
+}
+
+//Fetches the items with ids concurrently. Items that fail to fetch are logged and left out. Comments
+//in cache that haven't outlived its ttl aren't fetched again and fetched comments are cached
+func fetchItems(ctx context.Context, ids []int64, cache *commentCache) map[int64]*hnItem {
+	items := make(map[int64]*hnItem, len(ids))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			var item *hnItem
+			if cache != nil {
+				if c, ok := cache.get(id); ok {
+					item = &hnItem{By: c.By, ID: c.ID, Parent: c.Parent, Text: c.Text, Type: "comment"}
+				}
+			}
+			if item == nil {
+				//Stories end the walk, so only the comments among the items are cached
+				var fetched struct {
+					hnComment
+					Type string `json:"type"`
+				}
+				if _, err := fetchObject(ctx, itemURL(id), &fetched); err != nil {
+					//Once the context is done every remaining parent fails the same way
+					if ctx.Err() == nil {
+						log.Printf("Skipping parent %d: %v", id, err)
+					}
+					return
+				}
+				fetched.Text = html.UnescapeString(fetched.Text)
+				if fetched.Type == "comment" && cache != nil {
+					cache.put(fetched.hnComment)
+				}
+				item = &hnItem{By: fetched.By, ID: fetched.ID, Parent: fetched.Parent, Text: fetched.Text, Type: fetched.Type}
+			}
+			mu.Lock()
+			items[id] = item
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+	return items
+}
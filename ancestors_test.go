@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAttachAncestorsCommentCacheTTL(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path != "/v0/item/10.json" {
+			fmt.Fprint(w, "null")
+			return
+		}
+		fmt.Fprint(w, `{"by":"alice","id":10,"parent":100,"text":"Edited &amp; fresh","type":"comment"}`)
+	}))
+	defer server.Close()
+	base := apiBase
+	apiBase = server.URL + "/v0"
+	defer func() { apiBase = base }()
+
+	cache := &commentCache{dir: t.TempDir(), ttl: time.Hour}
+	cache.put(hnComment{By: "alice", ID: 10, Parent: 100, Text: "Stale"})
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(cache.path(10), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	comments := []hnComment{{By: "bob", ID: 11, Parent: 10, Text: "Reply"}}
+	attachAncestors(context.Background(), comments, 1, cache)
+	if len(comments[0].Ancestors) != 1 || comments[0].Ancestors[0].Text != "Edited & fresh" {
+		t.Fatalf("got ancestors %+v, want the refetched parent", comments[0].Ancestors)
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("sent %d requests, want 1", requests)
+	}
+
+	//The refetched parent is cached again and now fresh
+	attachAncestors(context.Background(), comments, 1, cache)
+	if len(comments[0].Ancestors) != 1 || comments[0].Ancestors[0].Text != "Edited & fresh" {
+		t.Errorf("got ancestors %+v from the cache", comments[0].Ancestors)
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("sent %d requests, want the parent read from the cache", requests)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+//How many users -withAuthorInfo looks up at once
+const authorInfoWorkers = 8
+
+//Orders for -sort
+const sortByKarma = "karma"
+
+func validateSort(order string) error {
+	if order == "" || order == sortByKarma {
+		return nil
+	}
+	return fmt.Errorf("unknown -sort %q, expected karma", order)
+}
+
+//Looks up the author of every comment and sets their karma. Each distinct author costs one
+//request. Authors that can't be looked up are logged and left without karma
+func addAuthorInfo(ctx context.Context, comments []hnComment) {
+	var authors []string
+	seen := make(map[string]bool)
+	for _, c := range comments {
+		if c.By != "" && !seen[c.By] {
+			seen[c.By] = true
+			authors = append(authors, c.By)
+		}
+	}
+
+	var mu sync.Mutex
+	karma := make(map[string]int, len(authors))
+	names := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < authorInfoWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				var user hnUser
+				if _, err := fetchObject(ctx, fmt.Sprintf("%s/user/%s.json", apiBase, name), &user); err != nil {
+					log.Printf("Couldn't look up user %s: %v", name, err)
+					continue
+				}
+				mu.Lock()
+				karma[name] = user.Karma
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, name := range authors {
+		if ctx.Err() != nil {
+			break
+		}
+		names <- name
+	}
+	close(names)
+	wg.Wait()
+
+	for i := range comments {
+		if k, ok := karma[comments[i].By]; ok {
+			comments[i].AuthorKarma = &k
+		}
+	}
+}
+
+//Sorts comments by their author's karma, highest first. Comments without karma go last and
+//comments with the same karma keep their order
+func sortByAuthorKarma(comments []hnComment) {
+	sort.SliceStable(comments, func(i, j int) bool {
+		a, b := comments[i].AuthorKarma, comments[j].AuthorKarma
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return *a > *b
+	})
+}
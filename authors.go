@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+//Keeps one comment per author, the one matching the most keywords if they were annotated and
+//otherwise the first. The kept comments stay in order. Comments without an author, e.g. deleted
+//ones, are all kept
+func uniqueAuthors(comments []hnComment) []hnComment {
+	best := make(map[string]int)
+	for i, c := range comments {
+		if c.By == "" {
+			continue
+		}
+		if j, ok := best[c.By]; !ok || len(c.Matched) > len(comments[j].Matched) {
+			best[c.By] = i
+		}
+	}
+
+	var unique []hnComment
+	for i, c := range comments {
+		if c.By == "" || best[c.By] == i {
+			unique = append(unique, c)
+		}
+	}
+	return unique
+}
+
+//Orders for -authors-sort
+const (
+	authorsByName  = "name"
+	authorsByCount = "count"
+)
+
+//An author and how many of the comments are theirs, as written by -authors-only
+type authorCount struct {
+	By       string `json:"by"`
+	Comments int    `json:"comments"`
+}
+
+//Returns the distinct authors of comments with their number of comments, sorted alphabetically or
+//by count, most comments first. Comments without an author are left out
+func countAuthors(comments []hnComment, sortBy string) []authorCount {
+	counts := make(map[string]int)
+	for _, c := range comments {
+		if c.By != "" {
+			counts[c.By]++
+		}
+	}
+
+	authors := make([]authorCount, 0, len(counts))
+	for by, n := range counts {
+		authors = append(authors, authorCount{By: by, Comments: n})
+	}
+	sort.Slice(authors, func(i, j int) bool {
+		if sortBy == authorsByCount && authors[i].Comments != authors[j].Comments {
+			return authors[i].Comments > authors[j].Comments
+		}
+		return authors[i].By < authors[j].By
+	})
+	return authors
+}
+
+//Writes authors as a JSON array, one JSON object per line with ndjson or a line per author
+//with their number of comments in the text formats
+func writeAuthors(w io.Writer, authors []authorCount, format string) error {
+	switch format {
+	case formatJSON:
+		return json.NewEncoder(w).Encode(authors)
+	case formatNDJSON:
+		encoder := json.NewEncoder(w)
+		for _, a := range authors {
+			if err := encoder.Encode(a); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		for _, a := range authors {
+			if _, err := fmt.Fprintf(w, "%s %d\n", a.By, a.Comments); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUniqueAuthors(t *testing.T) {
+	comments := []hnComment{
+		{By: "alice", ID: 1},
+		{By: "bob", ID: 2, Matched: []string{"go"}},
+		//Matches more keywords than alice's first comment, so it's the one kept
+		{By: "alice", ID: 3, Matched: []string{"go", "remote"}},
+		{By: "bob", ID: 4, Matched: []string{"rust"}},
+		{ID: 5, Deleted: true},
+		{ID: 6, Deleted: true},
+	}
+	var ids []int64
+	for _, c := range uniqueAuthors(comments) {
+		ids = append(ids, c.ID)
+	}
+	if want := []int64{2, 3, 5, 6}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("kept %v, want %v", ids, want)
+	}
+}
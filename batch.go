@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//The progress of fetching a list of threads, so an interrupted batch can be resumed with -resume
+type batchState struct {
+	Threads []int `json:"threads"`
+	Done    []int `json:"done"`
+}
+
+//Returns the state file of a batch of threads. Every list of threads has its own so resuming one
+//batch doesn't skip threads of another
+func batchStateFile(threadIDs []int) string {
+	ids := make([]string, len(threadIDs))
+	for i, id := range threadIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(ids, ",")))
+	return fmt.Sprintf("%s/batch-%x.json", cacheDir(), sum[:6])
+}
+
+//Reads the threads of the batch that are done, none if it has no state file
+func readBatchDone(filename string) (map[int]bool, error) {
+	done := make(map[int]bool)
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return done, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var state batchState
+	if err := json.NewDecoder(file).Decode(&state); err != nil {
+		return nil, fmt.Errorf("reading batch state %s: %v", filename, err)
+	}
+	for _, id := range state.Done {
+		done[id] = true
+	}
+	return done, nil
+}
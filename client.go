@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+//Fetching a thread sends a request per comment concurrently, keep enough idle connections to the
+//API host around to reuse them instead of opening new ones
+const maxIdleConnsPerHost = 100
+
+//The client every API request is sent with, so connections are shared between requests
+var httpClient = newHTTPClient(false)
+
+//Returns a client that keeps connections alive and negotiates HTTP/2 unless http1 is set
+func newHTTPClient(http1 bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	transport.ForceAttemptHTTP2 = !http1
+	if http1 {
+		//A non-nil empty map disables HTTP/2 on TLS connections
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return &http.Client{Transport: transport}
+}
+
+//The encodings requests accept. Setting it turns off the transport's own gzip handling, which
+//doesn't cover deflate, so responses are decoded by decodedBody instead
+const acceptEncoding = "gzip, deflate"
+
+//Returns the body of response decoded according to its Content-Encoding. Closing it doesn't
+//close the response body
+func decodedBody(response *http.Response) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(response.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return ioutil.NopCloser(response.Body), nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(response.Body)
+	case "deflate":
+		//deflate is meant to be zlib wrapped but some servers send raw deflate
+		body := bufio.NewReader(response.Body)
+		header, err := body.Peek(2)
+		if err != nil {
+			return nil, err
+		}
+		if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			return zlib.NewReader(body)
+		}
+		return flate.NewReader(body), nil
+	}
+	return nil, fmt.Errorf("unsupported Content-Encoding %q", response.Header.Get("Content-Encoding"))
+}
+
+//Logs the protocol of the first response from every host, with -verbose
+var verbose bool
+
+var loggedProtocols sync.Map
+
+func logProtocol(response *http.Response) {
+	if !verbose {
+		return
+	}
+	host := response.Request.URL.Host
+	if _, logged := loggedProtocols.LoadOrStore(host, true); !logged {
+		log.Printf("Connected to %s over %s", host, response.Proto)
+	}
+}
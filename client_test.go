@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const encodedItem = `{"by":"alice","id":1,"parent":100,"text":"Acme | Go | REMOTE"}`
+
+//Compresses encodedItem with the writer returned by compress
+func compressItem(t *testing.T, compress func(io.Writer) io.WriteCloser) []byte {
+	var b bytes.Buffer
+	w := compress(&b)
+	if _, err := io.WriteString(w, encodedItem); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestDecodedBody(t *testing.T) {
+	tests := []struct {
+		encoding string
+		body     []byte
+	}{
+		{"", []byte(encodedItem)},
+		{"identity", []byte(encodedItem)},
+		{"gzip", compressItem(t, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })},
+		{"deflate", compressItem(t, func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) })},
+		//Raw deflate without the zlib wrapper, which some servers send as deflate
+		{"deflate", compressItem(t, func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		})},
+	}
+	for i, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Accept-Encoding") != acceptEncoding {
+				t.Errorf("requested Accept-Encoding %q", r.Header.Get("Accept-Encoding"))
+			}
+			if test.encoding != "" {
+				w.Header().Set("Content-Encoding", test.encoding)
+			}
+			w.Write(test.body)
+		}))
+
+		_, body, err := fetchOnce(context.Background(), server.URL, nil)
+		server.Close()
+		if err != nil {
+			t.Errorf("%d %q: fetchOnce failed: %v", i, test.encoding, err)
+			continue
+		}
+		if string(body) != encodedItem {
+			t.Errorf("%d %q: got %q", i, test.encoding, body)
+		}
+	}
+}
+
+func TestDecodedBodyUnsupportedEncoding(t *testing.T) {
+	response := &http.Response{
+		Header: http.Header{"Content-Encoding": {"br"}},
+		Body:   ioutil.NopCloser(bytes.NewReader([]byte(encodedItem))),
+	}
+	if _, err := decodedBody(response); err == nil {
+		t.Error("decodedBody accepted br")
+	}
+}
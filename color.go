@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+//ANSI escape sequences used to highlight text output
+const (
+	colorReset   = "\x1b[0m"
+	colorCompany = "\x1b[1;36m"
+	colorRemote  = "\x1b[1;32m"
+	colorSalary  = "\x1b[1;33m"
+)
+
+//Reports whether output written to f should be colored. Every formatter that colors its output
+//decides with this. Color is only used on terminals that handle escapes and can be turned off with
+//noColor or by setting the NO_COLOR environment variable (https://no-color.org)
+func colorEnabled(f *os.File, noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(f)
+}
+
+//Wraps every occurrence of s in text with color
+func colorize(text, s, color string) string {
+	if s == "" {
+		return text
+	}
+	return strings.ReplaceAll(text, s, color+s+colorReset)
+}
+
+//Wraps every match of pattern in text with color
+func colorizePattern(text string, pattern *regexp.Regexp, color string) string {
+	return pattern.ReplaceAllString(text, color+"$0"+colorReset)
+}
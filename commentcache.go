@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+//Caches comments individually, keyed by comment ID, so comments shared between overlapping
+//fetches are only fetched once
+type commentCache struct {
+	dir string
+	//Comments cached longer than ttl ago are refetched, 0 never expires them. This is separate
+	//from the thread cache ttl since comments rarely change once posted
+	ttl time.Duration
+}
+
+func (c commentCache) path(id int64) string {
+	return filepath.Join(c.dir, fmt.Sprintf("%d.json", id))
+}
+
+//Returns the cached comment with id and whether it was found
+func (c commentCache) get(id int64) (comment hnComment, found bool) {
+	defer func() {
+		metrics.cacheLookup("comment", found)
+	}()
+
+	file, err := os.Open(c.path(id))
+	if err != nil {
+		return comment, false
+	}
+	defer file.Close()
+
+	if c.ttl > 0 {
+		info, err := file.Stat()
+		if err != nil || time.Since(info.ModTime()) > c.ttl {
+			return comment, false
+		}
+	}
+
+	if err := json.NewDecoder(file).Decode(&comment); err != nil {
+		log.Printf("Ignoring unreadable cached comment %s: %v", c.path(id), err)
+		return comment, false
+	}
+	return comment, true
+}
+
+//Caches comment. Failures are logged since the comment was fetched fine either way
+func (c commentCache) put(comment hnComment) {
+	if err := os.MkdirAll(c.dir, 0777); err != nil {
+		log.Println("Not caching comment:", err)
+		return
+	}
+	file, err := os.Create(c.path(comment.ID))
+	if err != nil {
+		log.Println("Not caching comment:", err)
+		return
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(comment); err != nil {
+		log.Println("Not caching comment:", err)
+	}
+}
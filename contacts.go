@@ -0,0 +1,121 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+//A dot of an obfuscated domain: bracketed, spelled out or a plain dot, which a sentence ending after
+//the address doesn't count as
+const domainDot = `(?:\s*(?:\[dot\]|\(dot\)|\{dot\})\s*|\s+dot\s+|\.)`
+
+var (
+	//The part of an obfuscated address after the user: a domain with its dots spelled out or
+	//bracketed, e.g. "acme [dot] com" or "acme dot co dot uk"
+	obfuscatedDomain = `([a-z0-9-]+(?:` + domainDot + `[a-z0-9-]+)+)`
+	//"name [at] acme [dot] com" and the like, with the at bracketed
+	bracketedEmailPattern = regexp.MustCompile(`(?i)\b([a-z0-9._%+-]+)\s*(?:\[at\]|\(at\)|\{at\}|<at>)\s*` + obfuscatedDomain)
+	//"email jobs at acme.com", a plain at is only an address right after asking to email it
+	emailAtPattern   = regexp.MustCompile(`(?i)\be-?mail(?:\s+(?:me|us))?\s*:?\s+([a-z0-9._%+-]+)\s+at\s+` + obfuscatedDomain)
+	domainDotPattern = regexp.MustCompile(`(?i)` + domainDot)
+	tldPattern       = regexp.MustCompile(`\.[a-z]{2,}$`)
+	//Links to job boards, applicant tracking systems and careers pages
+	applyLinkPattern = regexp.MustCompile(`(?i)(jobs|careers|apply|hiring|recruit|greenhouse\.io|lever\.co|workable\.com|ashbyhq\.com|bamboohr\.com|smartrecruiters\.com|wellfound\.com|ycombinator\.com/companies/[^/]+/jobs)`)
+)
+
+//How to apply to a posting, only set with -extractContacts
+type contacts struct {
+	//Plain and deobfuscated addresses, lowercased and deduped
+	Emails []string `json:"emails,omitempty"`
+	//Links to a job board, applicant tracking system or careers page
+	ApplyURLs []string `json:"applyUrls,omitempty"`
+}
+
+//Returns the addresses written to evade scrapers in text, e.g. "name [at] acme [dot] com" or
+//"email jobs at acme dot com", as plain addresses
+func extractObfuscatedEmails(text string) []string {
+	var emails []string
+	for _, pattern := range []*regexp.Regexp{bracketedEmailPattern, emailAtPattern} {
+		for _, match := range pattern.FindAllStringSubmatch(text, -1) {
+			domain := strings.ToLower(domainDotPattern.ReplaceAllString(match[2], "."))
+			if tldPattern.MatchString(domain) {
+				emails = append(emails, strings.ToLower(match[1])+"@"+domain)
+			}
+		}
+	}
+	return emails
+}
+
+//Returns the links that lead to applying, see applyLinkPattern
+func extractApplyLinks(links []string) []string {
+	var apply []string
+	for _, link := range links {
+		if applyLinkPattern.MatchString(link) {
+			apply = append(apply, link)
+		}
+	}
+	return apply
+}
+
+//Narrows extracted emails down by their domain, see -emailDomains and -excludeEmailDomains. An entry
+//matches its domain and all subdomains, so "io" matches every .io address
+type emailDomainFilter struct {
+	allow []string
+	deny  []string
+}
+
+//Splits a comma-separated list of domains, lowercased and without a leading @ or dot
+func parseEmailDomains(list string) []string {
+	var domains []string
+	for _, domain := range strings.Split(list, ",") {
+		domain = strings.TrimLeft(strings.ToLower(strings.TrimSpace(domain)), "@.")
+		if domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+func matchesDomain(email string, domains []string) bool {
+	domain := strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+	for _, d := range domains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+//Returns the emails with an allowed domain, all of them without an allowlist, that aren't denied
+func (f emailDomainFilter) apply(emails []string) []string {
+	if len(f.allow) == 0 && len(f.deny) == 0 {
+		return emails
+	}
+	var kept []string
+	for _, email := range emails {
+		if (len(f.allow) == 0 || matchesDomain(email, f.allow)) && !matchesDomain(email, f.deny) {
+			kept = append(kept, email)
+		}
+	}
+	return kept
+}
+
+//Returns how to apply to the posting in text, nil if it gives no way. Emails are deduped and then
+//narrowed down by domains
+func extractContacts(text string, domains emailDomainFilter) *contacts {
+	plain := stripHTML(text, linkText)
+	var emails []string
+	seen := make(map[string]bool)
+	for _, email := range append(extractEmails(plain), extractObfuscatedEmails(plain)...) {
+		email = strings.ToLower(email)
+		if !seen[email] {
+			seen[email] = true
+			emails = append(emails, email)
+		}
+	}
+	c := &contacts{Emails: domains.apply(emails), ApplyURLs: extractApplyLinks(extractLinks(text))}
+	if len(c.Emails) == 0 && len(c.ApplyURLs) == 0 {
+		return nil
+	}
+	return c
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractObfuscatedEmails(t *testing.T) {
+	tests := []struct {
+		text   string
+		emails []string
+	}{
+		{"Apply: jobs [at] acme [dot] com", []string{"jobs@acme.com"}},
+		{"hiring(at)beta(dot)io or cto {at} beta {dot} io", []string{"hiring@beta.io", "cto@beta.io"}},
+		{"Email jobs at gamma dot co dot uk. Apply today", []string{"jobs@gamma.co.uk"}},
+		{"email me: Jane.Doe at Delta.com", []string{"jane.doe@delta.com"}},
+		{"Please email us at careers [at] epsilon [dot] dev", []string{"careers@epsilon.dev"}},
+		//A sentence ending after the address isn't part of the domain
+		{"jobs [at] zeta.co.uk. Apply now", []string{"jobs@zeta.co.uk"}},
+		//"at" without asking to email isn't an address
+		{"We work at acme dot com scale", nil},
+		//Needs a TLD
+		{"jobs [at] localhost", nil},
+	}
+	for _, test := range tests {
+		if emails := extractObfuscatedEmails(test.text); !reflect.DeepEqual(emails, test.emails) {
+			t.Errorf("extractObfuscatedEmails(%q) = %v, want %v", test.text, emails, test.emails)
+		}
+	}
+}
+
+func TestExtractApplyLinks(t *testing.T) {
+	links := []string{
+		"https://acme.com",
+		"https://acme.com/careers",
+		"https://boards.greenhouse.io/acme/jobs/123",
+		"https://jobs.lever.co/beta",
+		"https://github.com/acme",
+		"https://www.ycombinator.com/companies/gamma/jobs",
+		"https://apply.workable.com/delta/",
+	}
+	want := []string{
+		"https://acme.com/careers",
+		"https://boards.greenhouse.io/acme/jobs/123",
+		"https://jobs.lever.co/beta",
+		"https://www.ycombinator.com/companies/gamma/jobs",
+		"https://apply.workable.com/delta/",
+	}
+	if apply := extractApplyLinks(links); !reflect.DeepEqual(apply, want) {
+		t.Errorf("extractApplyLinks = %v, want %v", apply, want)
+	}
+}
+
+func TestExtractContacts(t *testing.T) {
+	text := `Acme | Go | REMOTE<p>Email Jobs@Acme.com or jobs [at] acme [dot] com, ` +
+		`or apply at <a href="https://acme.com/careers">acme.com/careers</a>`
+	want := &contacts{Emails: []string{"jobs@acme.com"}, ApplyURLs: []string{"https://acme.com/careers"}}
+	if c := extractContacts(text, emailDomainFilter{}); !reflect.DeepEqual(c, want) {
+		t.Errorf("extractContacts = %+v, want %+v", c, want)
+	}
+	if c := extractContacts("Acme | Go | REMOTE", emailDomainFilter{}); c != nil {
+		t.Errorf("extractContacts of a posting without contacts = %+v, want nil", c)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//An amount in a salary like "120k" or "90,000"
+var salaryAmountPattern = regexp.MustCompile(`(?i)(\d[\d,.]*)\s?(k?)`)
+
+//An amount with dots as thousands separators like "90.000"
+var dotThousandsPattern = regexp.MustCompile(`^\d{1,3}(\.\d{3})+$`)
+
+//The columns of -format summary-csv
+var summaryColumns = []string{"company", "location", "remote", "seniority", "salary_min", "salary_max", "emails", "links", "permalink"}
+
+//Reads comments from CSV. The first record is a header naming the columns; by, id, parent, text
+//and time are recognized case-insensitively and any other columns are ignored, so files exported by
+//other tools can be re-filtered as long as they use the same column names. Without an id column the
+//IDs are taken from the HN links in a permalink column, like -format summary-csv writes
+func fetchFromCSV(r io.Reader) ([]hnComment, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %v", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	_, hasID := columns["id"]
+	if _, ok := columns["permalink"]; !ok && !hasID {
+		return nil, fmt.Errorf("CSV header %q has no id or permalink column", strings.Join(header, ","))
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+	number := func(record []string, name string) (int64, error) {
+		value := strings.TrimSpace(field(record, name))
+		if value == "" {
+			return 0, nil
+		}
+		return strconv.ParseInt(value, 10, 64)
+	}
+
+	var comments []hnComment
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		var id int64
+		if hasID {
+			id, err = number(record, "id")
+		} else {
+			id, err = idFromPermalink(field(record, "permalink"))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid id: %v", line, err)
+		}
+		parent, err := number(record, "parent")
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid parent: %v", line, err)
+		}
+		postedAt, err := number(record, "time")
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid time: %v", line, err)
+		}
+		comments = append(comments, hnComment{
+			By:     field(record, "by"),
+			ID:     id,
+			Parent: parent,
+			Text:   field(record, "text"),
+			Time:   postedAt,
+		})
+	}
+	return comments, nil
+}
+
+//Returns the ID of the item an HN link like https://news.ycombinator.com/item?id=1 points to, 0 if
+//link is empty
+func idFromPermalink(link string) (int64, error) {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return 0, nil
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return 0, err
+	}
+	id := u.Query().Get("id")
+	if id == "" {
+		return 0, fmt.Errorf("%q isn't a link to an HN item", link)
+	}
+	return strconv.ParseInt(id, 10, 64)
+}
+
+//Parses the bounds of an extracted salary like "$120k - $160k". A single amount is both bounds and a
+//k after only the upper bound, as in "$120-160k", applies to both. Reports false if salary has no
+//amount
+func parseSalaryRange(salary string) (int64, int64, bool) {
+	var amounts []float64
+	var thousands []bool
+	for _, match := range salaryAmountPattern.FindAllStringSubmatch(salary, 2) {
+		amount := strings.ReplaceAll(strings.TrimRight(match[1], ".,"), ",", "")
+		if match[2] == "" && dotThousandsPattern.MatchString(amount) {
+			amount = strings.ReplaceAll(amount, ".", "")
+		}
+		value, err := strconv.ParseFloat(amount, 64)
+		if err != nil {
+			continue
+		}
+		amounts = append(amounts, value)
+		thousands = append(thousands, match[2] != "")
+	}
+	switch len(amounts) {
+	case 0:
+		return 0, 0, false
+	case 1:
+		if thousands[0] {
+			amounts[0] *= 1000
+		}
+		return int64(amounts[0]), int64(amounts[0]), true
+	}
+	if thousands[1] && !thousands[0] && amounts[0] < 1000 {
+		thousands[0] = true
+	}
+	for i := range amounts {
+		if thousands[i] {
+			amounts[i] *= 1000
+		}
+	}
+	return int64(amounts[0]), int64(amounts[1]), true
+}
+
+//Writes a CSV row per comment with the fields extracted from it, for spreadsheets. Run extract
+//first. The location comes from the posting's header line. Fields that couldn't be extracted are
+//left blank and lists are separated by semicolons
+func writeSummaryCSV(w io.Writer, comments []hnComment) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(summaryColumns); err != nil {
+		return err
+	}
+	for _, c := range comments {
+		header := c.Header
+		if header == nil {
+			header = parseHeader(c.Text)
+		}
+		var location, salaryMin, salaryMax string
+		if header != nil {
+			location = header.Location
+		}
+		if min, max, ok := parseSalaryRange(c.Salary); ok {
+			salaryMin, salaryMax = strconv.FormatInt(min, 10), strconv.FormatInt(max, 10)
+		}
+		err := writer.Write([]string{
+			c.Company,
+			location,
+			c.Remote,
+			strings.Join(c.Seniority, ";"),
+			salaryMin,
+			salaryMax,
+			strings.Join(c.Emails, ";"),
+			strings.Join(c.Links, ";"),
+			permalink(c.ID),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
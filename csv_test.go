@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSalaryRange(t *testing.T) {
+	tests := []struct {
+		salary   string
+		min, max int64
+		ok       bool
+	}{
+		{"$120k - $160k", 120000, 160000, true},
+		{"$120-160k", 120000, 160000, true},
+		{"$120 - 160K", 120000, 160000, true},
+		{"$90,000 - $110,000", 90000, 110000, true},
+		{"€90.000 - €110.000", 90000, 110000, true},
+		{"€1.200.000", 1200000, 1200000, true},
+		{"$150k", 150000, 150000, true},
+		{"$1.5k - $2k", 1500, 2000, true},
+		{"$50,000-160k", 50000, 160000, true},
+		{"competitive", 0, 0, false},
+	}
+	for _, test := range tests {
+		min, max, ok := parseSalaryRange(test.salary)
+		if min != test.min || max != test.max || ok != test.ok {
+			t.Errorf("parseSalaryRange(%q) = %d, %d, %v, want %d, %d, %v", test.salary, min, max, ok, test.min, test.max, test.ok)
+		}
+	}
+}
+
+func TestFetchFromCSV(t *testing.T) {
+	file := "ID,By,Parent,Text,Time,Extra\n1,alice,100,\"Acme | Go, Rust\",1700000000,x\n2,bob,100,Beta,,\n"
+	comments, err := fetchFromCSV(strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []hnComment{
+		{By: "alice", ID: 1, Parent: 100, Text: "Acme | Go, Rust", Time: 1700000000},
+		{By: "bob", ID: 2, Parent: 100, Text: "Beta"},
+	}
+	if !reflect.DeepEqual(comments, want) {
+		t.Errorf("got %+v, want %+v", comments, want)
+	}
+
+	if _, err := fetchFromCSV(strings.NewReader("by,text\nalice,Acme\n")); err == nil {
+		t.Error("fetchFromCSV accepted a header without an id or permalink column")
+	}
+}
+
+//-format summary-csv has no id column, only permalinks
+func TestSummaryCSVRoundTrip(t *testing.T) {
+	exported := []hnComment{
+		{By: "alice", ID: 1, Parent: 100, Text: "Acme | Go | REMOTE", Company: "Acme", Salary: "$120-160k"},
+		{By: "bob", ID: 2, Parent: 100, Text: "Beta | Rust | Berlin", Company: "Beta"},
+	}
+	var b bytes.Buffer
+	if err := writeSummaryCSV(&b, exported); err != nil {
+		t.Fatal(err)
+	}
+	comments, err := fetchFromCSV(&b)
+	if err != nil {
+		t.Fatalf("fetchFromCSV failed: %v", err)
+	}
+	var ids []int64
+	for _, c := range comments {
+		ids = append(ids, c.ID)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 2}) {
+		t.Errorf("read IDs %v, want [1 2]", ids)
+	}
+
+	if _, err := fetchFromCSV(strings.NewReader("permalink\nhttps://example.com/jobs\n")); err == nil {
+		t.Error("fetchFromCSV accepted a permalink without an item ID")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+//Presets for -date-format, any other value is used as a Go time layout
+var dateFormatPresets = map[string]string{
+	"rfc3339":  time.RFC3339,
+	"date":     "2006-01-02",
+	"datetime": "2006-01-02 15:04:05",
+}
+
+//Renders the Unix time t in UTC with format, a preset, unix for the seconds since the epoch or a
+//Go time layout like "02/01/2006"
+func formatCreatedAt(t int64, format string) string {
+	if format == "unix" {
+		return strconv.FormatInt(t, 10)
+	}
+	if layout, ok := dateFormatPresets[format]; ok {
+		format = layout
+	}
+	return time.Unix(t, 0).UTC().Format(format)
+}
+
+//Sets CreatedAt of the comments that have a time
+func setCreatedAt(comments []hnComment, format string) {
+	for i := range comments {
+		if comments[i].Time != 0 {
+			comments[i].CreatedAt = formatCreatedAt(comments[i].Time, format)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//Keys for -dedupeBy
+const (
+	dedupeByID     = "id"
+	dedupeByText   = "text"
+	dedupeByAuthor = "author"
+)
+
+func validateDedupeBy(key string) error {
+	switch key {
+	case dedupeByID, dedupeByText, dedupeByAuthor:
+		return nil
+	}
+	return fmt.Errorf("unknown -dedupeBy %q, expected id, text or author", key)
+}
+
+//Returns a hash of the text of c without HTML, case and differences in whitespace, so reposts that
+//only differ in formatting hash the same
+func normalizedTextHash(c hnComment) string {
+	text := strings.Join(strings.Fields(strings.ToLower(stripHTML(c.Text, linkText))), " ")
+	if text == "" {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(text)))
+}
+
+//Returns the value of the dedupe key of c, empty if c has none, e.g. a deleted comment's author or
+//the ID of a comment read from a file without IDs
+func dedupeKey(c hnComment, key string) string {
+	switch key {
+	case dedupeByText:
+		return normalizedTextHash(c)
+	case dedupeByAuthor:
+		return c.By
+	default:
+		if c.ID == 0 {
+			return ""
+		}
+		return strconv.FormatInt(c.ID, 10)
+	}
+}
+
+//Keeps the first comment of every value of key, in order. Comments without a value are all kept
+func dedupeComments(comments []hnComment, key string) []hnComment {
+	seen := make(map[string]bool)
+	var unique []hnComment
+	for _, c := range comments {
+		k := dedupeKey(c, key)
+		if k != "" && seen[k] {
+			continue
+		}
+		seen[k] = true
+		unique = append(unique, c)
+	}
+	return unique
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDedupeComments(t *testing.T) {
+	comments := []hnComment{
+		{By: "alice", ID: 1, Text: "Acme | Go | <i>Remote</i>"},
+		{By: "bob", ID: 2, Text: "Beta | Rust"},
+		{By: "alice", ID: 1, Text: "Acme | Go | <i>Remote</i>"},
+		//A repost that only differs in case, HTML and whitespace
+		{By: "carol", ID: 3, Text: "acme |  go  | remote"},
+		{By: "alice", ID: 4, Text: "Gamma | Python"},
+		//Deleted comments have no author or text and are all kept
+		{ID: 5, Deleted: true},
+		{ID: 6, Deleted: true},
+		//Comments read from files without IDs are all kept too
+		{By: "dave", Text: "Delta | Ruby"},
+		{By: "erin", Text: "Epsilon | Go"},
+	}
+	tests := []struct {
+		key string
+		ids []int64
+	}{
+		{dedupeByID, []int64{1, 2, 3, 4, 5, 6, 0, 0}},
+		{dedupeByText, []int64{1, 2, 4, 5, 6, 0, 0}},
+		{dedupeByAuthor, []int64{1, 2, 3, 5, 6, 0, 0}},
+	}
+	for _, test := range tests {
+		var ids []int64
+		for _, c := range dedupeComments(comments, test.key) {
+			ids = append(ids, c.ID)
+		}
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("-dedupeBy %s kept %v, want %v", test.key, ids, test.ids)
+		}
+	}
+}
+
+func TestValidateDedupeBy(t *testing.T) {
+	for _, key := range []string{dedupeByID, dedupeByText, dedupeByAuthor} {
+		if err := validateDedupeBy(key); err != nil {
+			t.Errorf("validateDedupeBy(%q) failed: %v", key, err)
+		}
+	}
+	if validateDedupeBy("url") == nil {
+		t.Error("validateDedupeBy accepted url")
+	}
+}
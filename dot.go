@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+//The number of characters of a comment's text in its node label
+const dotLabelSnippetSize = 40
+
+//Quotes s as a DOT string
+func dotQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+	return `"` + s + `"`
+}
+
+//Returns the label of the node of c, its author and the start of its text on a second line
+func dotLabel(c hnComment) string {
+	text := strings.Join(strings.Fields(stripHTML(c.Text, linkText)), " ")
+	if utf8.RuneCountInString(text) > dotLabelSnippetSize {
+		text = string([]rune(text)[:dotLabelSnippetSize]) + snippetEllipsis
+	}
+	return c.By + opMarker(c) + "\n" + text
+}
+
+//Writes comments as a GraphViz DOT digraph with a node per comment and an edge from every comment
+//to each of its replies. Parents that aren't among comments, such as the story of top-level
+//comments, get a plain node of their own so the roots stay connected
+func writeDOT(w io.Writer, comments []hnComment) error {
+	var b strings.Builder
+	b.WriteString("digraph comments {\n\tnode [shape=box];\n")
+	present := make(map[int64]bool, len(comments))
+	for _, c := range comments {
+		present[c.ID] = true
+	}
+	outside := make(map[int64]bool)
+	for _, c := range comments {
+		fmt.Fprintf(&b, "\t%d [label=%s, URL=%s];\n", c.ID, dotQuote(dotLabel(c)), dotQuote(permalink(c.ID)))
+		if c.Parent == 0 {
+			continue
+		}
+		if !present[c.Parent] && !outside[c.Parent] {
+			outside[c.Parent] = true
+			fmt.Fprintf(&b, "\t%d [label=%s, URL=%s, shape=ellipse];\n", c.Parent,
+				dotQuote(fmt.Sprintf("item %d", c.Parent)), dotQuote(permalink(c.Parent)))
+		}
+		fmt.Fprintf(&b, "\t%d -> %d;\n", c.Parent, c.ID)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
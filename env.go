@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+//Prefix of the environment variables that set flags
+const envPrefix = "HN_"
+
+//Returns the environment variable that sets the flag name, HN_ and the name in upper snake case,
+//e.g. HN_THREAD_ID for -threadID and HN_CACHE_TTL for -cache-ttl
+func envName(name string) string {
+	var b strings.Builder
+	b.WriteString(envPrefix)
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case r == '-':
+			b.WriteRune('_')
+		case unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])):
+			b.WriteRune('_')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
+
+//Sets the flags of fs that weren't given on the command line from their environment variables,
+//so flags always take precedence. Call it after parsing
+func flagsFromEnv(fs *flag.FlagSet, lookupEnv func(string) (string, bool)) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		value, ok := lookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value %q for %s: %v", value, envName(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+//A resolved flag value and where it came from: flag, env or default
+type configValue struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+//Flags whose values resolvedConfig hides
+var secretFlags = map[string]bool{"translateKey": true, "kafkaPassword": true}
+
+//Returns the value of every flag of fs after flagsFromEnv ran, with secrets masked. fromCommandLine holds the names of
+//the flags that were given on the command line, the other flags that are set came from the
+//environment
+func resolvedConfig(fs *flag.FlagSet, fromCommandLine map[string]bool) map[string]configValue {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	config := make(map[string]configValue)
+	fs.VisitAll(func(f *flag.Flag) {
+		source := "default"
+		if fromCommandLine[f.Name] {
+			source = "flag"
+		} else if set[f.Name] {
+			source = "env"
+		}
+		value := f.Value.String()
+		if secretFlags[f.Name] && value != "" {
+			value = "***"
+		}
+		config[f.Name] = configValue{Value: value, Source: source}
+	})
+	return config
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	anchorPattern = regexp.MustCompile(`(?is)<a\s[^>]*>.*?</a>`)
+	hrefPattern   = regexp.MustCompile(`(?i)href\s*=\s*"([^"]+)"`)
+	urlPattern    = regexp.MustCompile(`https?://[^\s"'<>]+`)
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	//Amounts like $120k, €90,000 or $120k - $160k
+	salaryPattern = regexp.MustCompile(`(?i)[$€£]\s?\d[\d,.]*\s?k?(?:\s?(?:-|–|to)\s?[$€£]?\s?\d[\d,.]*\s?k?)?`)
+	remotePattern = regexp.MustCompile(`(?i)\b(remote|hybrid|on-?site)\b`)
+
+	//Normalized employment types and the phrasings that indicate them
+	employmentTypePatterns = []struct {
+		name    string
+		pattern *regexp.Regexp
+	}{
+		{"fulltime", regexp.MustCompile(`(?i)\bfull[- ]?time\b`)},
+		{"parttime", regexp.MustCompile(`(?i)\bpart[- ]?time\b`)},
+		{"contract", regexp.MustCompile(`(?i)\b(contract(or|ors|ing)?|freelance(r|rs)?)\b`)},
+		{"intern", regexp.MustCompile(`(?i)\bintern(s|ship|ships)?\b`)},
+	}
+
+	//Normalized seniority levels, most junior first, and the phrasings that indicate them. staff,
+	//principal and lead are common words on their own so they only count as part of a job title
+	seniorityPatterns = []struct {
+		name    string
+		pattern *regexp.Regexp
+	}{
+		{"junior", regexp.MustCompile(`(?i)\b(junior|jr\.?|entry[- ]level|new[- ]grad(uate)?s?)(\W|$)`)},
+		{"mid", regexp.MustCompile(`(?i)\b(mid[- ]?level|mid[- ]senior|intermediate)\b`)},
+		{"senior", regexp.MustCompile(`(?i)\b(senior|sr\.?)(\W|$)`)},
+		{"staff", regexp.MustCompile(`(?i)\bstaff[- ](software |data |ml |security )?(engineers?|developers?|scientists?|designers?|level)\b`)},
+		{"principal", regexp.MustCompile(`(?i)\bprincipal[- ](software |data |ml |security )?(engineers?|developers?|scientists?|designers?|architects?)\b`)},
+		{"lead", regexp.MustCompile(`(?i)\b(tech(nical)?|team|engineering)[- ]leads?\b|\blead[- ](software |data |ml |security )?(engineers?|developers?|scientists?|designers?)\b`)},
+	}
+)
+
+//Returns the links in a comment's text in order of appearance. Both anchor hrefs and bare URLs
+//are picked up. HN puts the full URL in the href and a possibly truncated one in the anchor text,
+//so anchors are blanked out before looking for bare URLs
+func extractLinks(text string) []string {
+	type found struct {
+		offset int
+		link   string
+	}
+	var matches []found
+	for _, match := range hrefPattern.FindAllStringSubmatchIndex(text, -1) {
+		link := text[match[2]:match[3]]
+		if !strings.HasPrefix(strings.ToLower(link), "mailto:") {
+			matches = append(matches, found{match[0], link})
+		}
+	}
+	//Blanked out rather than removed so the offsets of the bare URLs match the text
+	withoutAnchors := anchorPattern.ReplaceAllStringFunc(text, func(anchor string) string {
+		return strings.Repeat(" ", len(anchor))
+	})
+	for _, match := range urlPattern.FindAllStringIndex(withoutAnchors, -1) {
+		link := strings.TrimRight(text[match[0]:match[1]], ".,;:!?)")
+		matches = append(matches, found{match[0], link})
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].offset < matches[j].offset })
+
+	var links []string
+	seen := make(map[string]bool)
+	for _, match := range matches {
+		if !seen[match.link] {
+			links = append(links, match.link)
+			seen[match.link] = true
+		}
+	}
+	return links
+}
+
+//Returns the email addresses in a comment's text in order of appearance
+func extractEmails(text string) []string {
+	return emailPattern.FindAllString(text, -1)
+}
+
+//Returns the first salary or salary range mentioned in text
+func extractSalary(text string) string {
+	return strings.TrimSpace(salaryPattern.FindString(text))
+}
+
+//Returns remote, hybrid or onsite for the first mention of a work arrangement in text
+func extractRemote(text string) string {
+	match := strings.ToLower(remotePattern.FindString(text))
+	if strings.HasPrefix(match, "on") {
+		return "onsite"
+	}
+	return match
+}
+
+//Returns the company of a Who's Hiring post, the first field of a header line like
+//"Acme | Engineer | Remote". Posts without such a header have no company
+func extractCompany(text string) string {
+	header := stripHTML(paragraphPattern.Split(text, 2)[0], linkText)
+	fields := strings.Split(header, "|")
+	if len(fields) < 2 {
+		return ""
+	}
+	return strings.TrimSpace(fields[0])
+}
+
+//Returns the normalized employment types a posting mentions: fulltime, parttime, contract and
+//intern, in that order. A posting can offer several
+func classifyEmploymentTypes(text string) []string {
+	var types []string
+	for _, t := range employmentTypePatterns {
+		if t.pattern.MatchString(text) {
+			types = append(types, t.name)
+		}
+	}
+	return types
+}
+
+//Normalizes a -employmentType value like "full-time" or "Internship" to the name used by
+//classifyEmploymentTypes
+func normalizeEmploymentType(value string) (string, error) {
+	for _, t := range employmentTypePatterns {
+		if t.pattern.MatchString(value) || strings.EqualFold(value, t.name) {
+			return t.name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown employment type %q, expected fulltime, parttime, contract or intern", value)
+}
+
+//Keeps comments offering any of the employment types
+func filterEmploymentTypes(types []string) filterFunction {
+	return func(c *hnComment) bool {
+		for _, t := range classifyEmploymentTypes(c.Text) {
+			if containsString(types, t) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//Returns the normalized seniority levels a posting mentions: junior, mid, senior, staff, principal
+//and lead, in that order. A posting hiring for several roles can mention several
+func classifySeniority(text string) []string {
+	var levels []string
+	for _, l := range seniorityPatterns {
+		if l.pattern.MatchString(text) {
+			levels = append(levels, l.name)
+		}
+	}
+	return levels
+}
+
+//Normalizes a -seniority value like "Sr" or "entry-level" to the name used by classifySeniority
+func normalizeSeniority(value string) (string, error) {
+	for _, l := range seniorityPatterns {
+		if strings.EqualFold(value, l.name) || l.pattern.MatchString(value) {
+			return l.name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown seniority %q, expected junior, mid, senior, staff, principal or lead", value)
+}
+
+//Keeps comments mentioning any of the seniority levels, and those that don't mention a level at
+//all as most postings don't say
+func filterSeniority(levels []string) filterFunction {
+	return func(c *hnComment) bool {
+		mentioned := classifySeniority(c.Text)
+		if len(mentioned) == 0 {
+			return true
+		}
+		for _, l := range mentioned {
+			if containsString(levels, l) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//Keeps comments by any of the authors. HN usernames are case-sensitive, so handles match exactly
+//unless ignoreCase is set
+func filterAuthors(authors []string, ignoreCase bool) filterFunction {
+	return func(c *hnComment) bool {
+		for _, a := range authors {
+			if c.By == a || (ignoreCase && strings.EqualFold(c.By, a)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//Keeps comments with an extracted link, run extract first
+func filterHasLink(c *hnComment) bool {
+	return len(c.Links) > 0
+}
+
+//Keeps comments with an extracted email, run extract first
+func filterHasEmail(c *hnComment) bool {
+	return len(c.Emails) > 0
+}
+
+//Configures extract
+type extractOptions struct {
+	//Dedupe and sort links and emails
+	normalize bool
+	//The dictionary tags are extracted with
+	tags []tagRule
+	//Applied to the emails after they're normalized
+	emailDomains emailDomainFilter
+}
+
+//Populates the extracted fields of c from its text
+func extract(c *hnComment, options extractOptions) {
+	c.Links = extractLinks(c.Text)
+	c.Emails = extractEmails(c.Text)
+	c.Company = extractCompany(c.Text)
+	c.Remote = extractRemote(c.Text)
+	c.Salary = extractSalary(c.Text)
+	c.EmploymentTypes = classifyEmploymentTypes(c.Text)
+	c.Seniority = classifySeniority(c.Text)
+	c.Tags = extractTags(c.Text, options.tags)
+	if options.normalize {
+		c.Links = normalizeExtracted(c.Links, false)
+		c.Emails = normalizeExtracted(c.Emails, true)
+	}
+	c.Emails = options.emailDomains.apply(c.Emails)
+}
+
+//Dedupes values case-insensitively, keeping the first spelling, and sorts them. With lower the
+//values are lowercased as well, which is safe for emails but not for URL paths
+func normalizeExtracted(values []string, lower bool) []string {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		key := strings.ToLower(value)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if lower {
+			value = key
+		}
+		normalized = append(normalized, value)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
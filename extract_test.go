@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassifyEmploymentTypes(t *testing.T) {
+	tests := []struct {
+		text  string
+		types []string
+	}{
+		{"Acme | Go Engineer | Full-time | REMOTE", []string{"fulltime"}},
+		{"Beta | Designer | fulltime or part time", []string{"fulltime", "parttime"}},
+		{"Gamma | Contractors welcome, freelance OK", []string{"contract"}},
+		{"Delta | Summer Internships | NYC", []string{"intern"}},
+		{"Epsilon | Full Time, Contract-to-hire, Interns", []string{"fulltime", "contract", "intern"}},
+		//International and internal aren't internships
+		{"Zeta | International team, internal tools", nil},
+	}
+	for _, test := range tests {
+		if types := classifyEmploymentTypes(test.text); !reflect.DeepEqual(types, test.types) {
+			t.Errorf("classifyEmploymentTypes(%q) = %v, want %v", test.text, types, test.types)
+		}
+	}
+}
+
+func TestNormalizeEmploymentType(t *testing.T) {
+	tests := map[string]string{
+		"fulltime":   "fulltime",
+		"Full-Time":  "fulltime",
+		"part time":  "parttime",
+		"freelance":  "contract",
+		"Internship": "intern",
+	}
+	for value, want := range tests {
+		if got, err := normalizeEmploymentType(value); err != nil || got != want {
+			t.Errorf("normalizeEmploymentType(%q) = %q, %v, want %q", value, got, err, want)
+		}
+	}
+	if _, err := normalizeEmploymentType("volunteer"); err == nil {
+		t.Error("normalizeEmploymentType accepted volunteer")
+	}
+}
+
+func TestClassifySeniority(t *testing.T) {
+	tests := []struct {
+		text   string
+		levels []string
+	}{
+		{"Acme | Senior / Staff Software Engineer | Remote", []string{"senior", "staff"}},
+		{"Foo | Junior Developer, new grads welcome", []string{"junior"}},
+		{"Bar | Engineer | we lead the market, our staff is great", nil},
+		{"Baz | Tech Lead, Sr. backend eng", []string{"senior", "lead"}},
+		{"Qux | Principal Architect | Entry-level too", []string{"junior", "principal"}},
+		{"Mid-level and senior engineers", []string{"mid", "senior"}},
+	}
+	for _, test := range tests {
+		if levels := classifySeniority(test.text); !reflect.DeepEqual(levels, test.levels) {
+			t.Errorf("classifySeniority(%q) = %v, want %v", test.text, levels, test.levels)
+		}
+	}
+}
+
+func TestExtractLinks(t *testing.T) {
+	tests := []struct {
+		text  string
+		links []string
+	}{
+		{`Apply at <a href="https://acme.com/jobs" rel="nofollow">https://acme.com/jo...</a>`, []string{"https://acme.com/jobs"}},
+		//A bare URL before an anchor comes first
+		{`See https://acme.com/about. Apply at <a href="https://acme.com/jobs">https://acme.com/jobs</a> or https://acme.com/careers`,
+			[]string{"https://acme.com/about", "https://acme.com/jobs", "https://acme.com/careers"}},
+		{`<a href="https://acme.com">https://acme.com</a> and again https://acme.com`, []string{"https://acme.com"}},
+		{`Email <a href="mailto:jobs@acme.com">jobs@acme.com</a>`, nil},
+	}
+	for _, test := range tests {
+		if links := extractLinks(test.text); !reflect.DeepEqual(links, test.links) {
+			t.Errorf("extractLinks(%q) = %v, want %v", test.text, links, test.links)
+		}
+	}
+}
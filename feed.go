@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+//The number of characters of a comment's text in its feed item title
+const feedTitleSnippetSize = 80
+
+const feedTitle = "Hacker News comments"
+
+const hnHomepage = "https://news.ycombinator.com/"
+
+//Returns the title of the feed item of c, its author and the start of its text
+func feedItemTitle(c hnComment) string {
+	text := strings.Join(strings.Fields(stripHTML(c.Text, linkText)), " ")
+	if utf8.RuneCountInString(text) > feedTitleSnippetSize {
+		text = string([]rune(text)[:feedTitleSnippetSize]) + snippetEllipsis
+	}
+	return fmt.Sprintf("%s%s: %s", c.By, opMarker(c), text)
+}
+
+//Returns the time c was posted, the zero time for comments cached before it was kept
+func commentTime(c hnComment) time.Time {
+	if c.Time == 0 {
+		return time.Time{}
+	}
+	return time.Unix(c.Time, 0).UTC()
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate,omitempty"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+//Writes comments as an RSS 2.0 feed with an item per comment. The HTML of a comment is its
+//escaped description, as RSS readers expect. With a story the feed is titled after it
+func writeRSS(w io.Writer, comments []hnComment, story *storyHeader) error {
+	feed := rssFeed{Version: "2.0", Channel: rssChannel{
+		Title:       feedTitle,
+		Link:        hnHomepage,
+		Description: "Comments selected by hn-comment-parser",
+	}}
+	if story != nil {
+		feed.Channel.Title = story.Title
+		feed.Channel.Link = story.Permalink
+	}
+	for _, c := range comments {
+		item := rssItem{
+			Title:       feedItemTitle(c),
+			Link:        permalink(c.ID),
+			GUID:        rssGUID{IsPermaLink: true, Value: permalink(c.ID)},
+			Description: c.Text,
+		}
+		if t := commentTime(c); !t.IsZero() {
+			item.PubDate = t.Format(time.RFC1123Z)
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	return writeXML(w, feed)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Updated string      `xml:"updated"`
+	Content atomContent `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+//Writes comments as an Atom feed with an entry per comment. Atom requires an updated time, the
+//feed's is the newest comment's and entries without a time use the feed's. With a story the feed
+//is titled after it
+func writeAtom(w io.Writer, comments []hnComment, story *storyHeader) error {
+	var newest time.Time
+	for _, c := range comments {
+		if t := commentTime(c); t.After(newest) {
+			newest = t
+		}
+	}
+	if newest.IsZero() {
+		newest = time.Now().UTC()
+	}
+
+	feed := atomFeed{
+		Title:   feedTitle,
+		ID:      hnHomepage,
+		Link:    atomLink{Href: hnHomepage},
+		Updated: newest.Format(time.RFC3339),
+	}
+	if story != nil {
+		feed.Title = story.Title
+		feed.ID = story.Permalink
+		feed.Link = atomLink{Href: story.Permalink}
+	}
+	for _, c := range comments {
+		updated := commentTime(c)
+		if updated.IsZero() {
+			updated = newest
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   feedItemTitle(c),
+			ID:      permalink(c.ID),
+			Link:    atomLink{Href: permalink(c.ID)},
+			Author:  atomAuthor{Name: c.By},
+			Updated: updated.Format(time.RFC3339),
+			Content: atomContent{Type: "html", Value: c.Text},
+		})
+	}
+	return writeXML(w, feed)
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+//Filters comments through an external command, for filtering logic that's easier to write in
+//another language. The protocol: the command is run through sh -c once per comment with the
+//comment's JSON object on stdin. Exiting 0 keeps the comment and any other exit status drops it.
+//Its stdout is ignored and its stderr is passed through. At most jobs commands run at once and
+//the order of comments is preserved. An error is returned if the command can't be started. If ctx
+//is done before every comment is checked, the comments kept so far are returned with ctx's error
+func filterWithCommand(ctx context.Context, comments []hnComment, command string, jobs int) ([]hnComment, error) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	keep := make([]bool, len(comments))
+	errs := make([]error, len(comments))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i := range comments {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			keep[i], errs[i] = runFilterCommand(ctx, command, &comments[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var kept []hnComment
+	for i, c := range comments {
+		if errs[i] != nil && ctx.Err() == nil {
+			return nil, errs[i]
+		}
+		if keep[i] {
+			kept = append(kept, c)
+		}
+	}
+	return kept, ctx.Err()
+}
+
+func runFilterCommand(ctx context.Context, command string, c *hnComment) (bool, error) {
+	input, err := json.Marshal(c)
+	if err != nil {
+		return false, err
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	//A command killed because ctx is done didn't get to decide
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+	return err == nil, err
+}
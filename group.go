@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+//Fields comments can be grouped by with -group-by
+const groupByTag = "tag"
+
+//The comments that share a tag
+type commentGroup struct {
+	Tag string `json:"tag"`
+	//The number of comments with the tag, which can be more than len(Comments) with a limit
+	Count    int         `json:"count"`
+	Comments []hnComment `json:"comments"`
+}
+
+func validateGroupBy(groupBy string) error {
+	if groupBy != groupByTag {
+		return fmt.Errorf("unknown -group-by %q, expected tag", groupBy)
+	}
+	return nil
+}
+
+//Groups comments by their extracted tags, most common tag first and alphabetically among equals.
+//A comment is listed under each of its tags and comments without tags are left out. If limit is
+//above 0 each group keeps only its first limit comments
+func groupCommentsByTag(comments []hnComment, limit int) []*commentGroup {
+	groups := make(map[string]*commentGroup)
+	for _, c := range comments {
+		for _, tag := range c.Tags {
+			group, ok := groups[tag]
+			if !ok {
+				group = &commentGroup{Tag: tag}
+				groups[tag] = group
+			}
+			group.Count++
+			if limit <= 0 || len(group.Comments) < limit {
+				group.Comments = append(group.Comments, c)
+			}
+		}
+	}
+
+	sorted := make([]*commentGroup, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Tag < sorted[j].Tag
+	})
+	return sorted
+}
+
+//Writes groups as a JSON array, one JSON object per line with ndjson or a markdown report with a
+//section per group
+func writeGroups(w io.Writer, groups []*commentGroup, options outputOptions) error {
+	switch options.format {
+	case formatNDJSON:
+		encoder := json.NewEncoder(w)
+		for _, group := range groups {
+			if err := encoder.Encode(group); err != nil {
+				return err
+			}
+		}
+		return nil
+	case formatMarkdown:
+		for _, group := range groups {
+			if _, err := fmt.Fprintf(w, "# %s (%d)\n\n", group.Tag, group.Count); err != nil {
+				return err
+			}
+			if err := writeMarkdown(w, group.Comments, false, options.linkStyle); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		var output interface{} = groups
+		if options.rootKey != "" {
+			output = map[string]interface{}{options.rootKey: output}
+		}
+		return json.NewEncoder(w).Encode(output)
+	}
+}
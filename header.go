@@ -0,0 +1,77 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	//Words that make a header field a job title
+	rolePattern = regexp.MustCompile(`(?i)\b(engineers?|developers?|designers?|managers?|scientists?|architects?|` +
+		`leads?|sre|devops|analysts?|researchers?|programmers?|cto|vp|head of|founding|staff|senior|junior)\b`)
+	//Fields that are links to the company or its job board rather than part of the posting
+	headerLinkPattern = regexp.MustCompile(`(?i)(https?://|www\.|\.(com|io|ai|co|dev|org|net)\b)`)
+	visaPattern       = regexp.MustCompile(`(?i)\bvisa\b`)
+)
+
+//The fields of a Who's Hiring header line like "Acme | Senior Engineer | Berlin | REMOTE | $120k".
+//Tags are all fields in order, the others are mapped from them on a best-effort basis and empty if
+//no field looks like one
+type postingHeader struct {
+	Tags     []string `json:"tags"`
+	Role     string   `json:"role,omitempty"`
+	Location string   `json:"location,omitempty"`
+	Remote   string   `json:"remote,omitempty"`
+	Comp     string   `json:"comp,omitempty"`
+}
+
+//Parses the header line of a posting, the text before its first paragraph or line break. Returns
+//nil if the line isn't split into at least two fields by pipes. The first field is the company,
+//see extractCompany, and isn't mapped
+func parseHeader(text string) *postingHeader {
+	line := paragraphPattern.Split(text, 2)[0]
+	line = stripHTML(strings.SplitN(line, "\n", 2)[0], linkText)
+	if !strings.Contains(line, "|") {
+		return nil
+	}
+
+	h := &postingHeader{}
+	for _, field := range strings.Split(line, "|") {
+		if field = strings.TrimSpace(field); field != "" {
+			h.Tags = append(h.Tags, field)
+		}
+	}
+	if len(h.Tags) < 2 {
+		return nil
+	}
+
+	for _, field := range h.Tags[1:] {
+		switch {
+		case salaryPattern.MatchString(field) || strings.Contains(strings.ToLower(field), "equity"):
+			if h.Comp == "" {
+				h.Comp = field
+			}
+		case remotePattern.MatchString(field):
+			if h.Remote == "" {
+				h.Remote = extractRemote(field)
+			}
+			//"Berlin or Remote" and "NYC (onsite)" name a location as well
+			place := strings.Trim(remotePattern.ReplaceAllString(field, ""), " ,;/()-")
+			place = strings.TrimSuffix(strings.TrimSpace(place), " or")
+			if h.Location == "" && place != "" && !strings.EqualFold(place, "only") {
+				h.Location = place
+			}
+		case rolePattern.MatchString(field):
+			if h.Role == "" {
+				h.Role = field
+			}
+		case headerLinkPattern.MatchString(field), visaPattern.MatchString(field),
+			len(classifyEmploymentTypes(field)) > 0:
+		default:
+			if h.Location == "" {
+				h.Location = field
+			}
+		}
+	}
+	return h
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		text   string
+		header *postingHeader
+	}{
+		{
+			"Acme | Senior Backend Engineer | Berlin | REMOTE | $120k - $160k<p>We build things",
+			&postingHeader{
+				Tags:     []string{"Acme", "Senior Backend Engineer", "Berlin", "REMOTE", "$120k - $160k"},
+				Role:     "Senior Backend Engineer",
+				Location: "Berlin",
+				Remote:   "remote",
+				Comp:     "$120k - $160k",
+			},
+		},
+		{
+			"Beta (YC W21) | NYC (onsite) | Full-time | Data Scientists | https://beta.com/jobs",
+			&postingHeader{
+				Tags:     []string{"Beta (YC W21)", "NYC (onsite)", "Full-time", "Data Scientists", "https://beta.com/jobs"},
+				Role:     "Data Scientists",
+				Location: "NYC",
+				Remote:   "onsite",
+			},
+		},
+		{
+			"Gamma |Founding Engineer|| London or Remote |Visa sponsorship | €90k + equity\nMore text",
+			&postingHeader{
+				Tags:     []string{"Gamma", "Founding Engineer", "London or Remote", "Visa sponsorship", "€90k + equity"},
+				Role:     "Founding Engineer",
+				Location: "London",
+				Remote:   "remote",
+				Comp:     "€90k + equity",
+			},
+		},
+		{"We're hiring engineers in Berlin. Email us", nil},
+		{"Delta |<p>Engineer | Remote", nil},
+	}
+	for _, test := range tests {
+		if h := parseHeader(test.text); !reflect.DeepEqual(h, test.header) {
+			t.Errorf("parseHeader(%q) = %+v, want %+v", test.text, h, test.header)
+		}
+	}
+}
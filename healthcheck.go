@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+//The item fetched by -healthcheck, the first HN story, which is small and never changes
+const healthcheckItemID = 1
+
+//Fetches a known item from backend and checks that it decodes, writing OK and the round trip
+//time to w
+func healthcheck(ctx context.Context, w io.Writer, backend string) error {
+	start := time.Now()
+	var id int64
+	if backend == backendAlgolia {
+		var item algoliaItem
+		if _, err := fetchObject(ctx, fmt.Sprintf(algoliaURLToFormat, int64(healthcheckItemID)), &item); err != nil {
+			return err
+		}
+		id = item.ID
+	} else {
+		thread, err := getThreadFromAPI(ctx, itemURL(healthcheckItemID))
+		if err != nil {
+			return err
+		}
+		id = thread.ID
+	}
+	if id != healthcheckItemID {
+		return fmt.Errorf("expected item %d, got item %d", healthcheckItemID, id)
+	}
+	_, err := fmt.Fprintf(w, "OK %s %s\n", backend, time.Since(start).Round(time.Millisecond))
+	return err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+//Periods for -histogram
+const (
+	histogramDay  = "day"
+	histogramHour = "hour"
+)
+
+const histogramBarWidth = 50
+
+func validateHistogramPeriod(period string) error {
+	switch period {
+	case histogramDay, histogramHour:
+		return nil
+	}
+	return fmt.Errorf("unknown histogram period %q, expected day or hour", period)
+}
+
+//Writes a text bar chart of the number of comments posted per period to w. day buckets comments by
+//date, listing the days without comments between the first and last one too, and hour by the hour
+//of the day. Both are in UTC. Comments without a time are left out
+func writeHistogram(w io.Writer, comments []hnComment, period string) error {
+	var labels []string
+	counts := make(map[string]int)
+	var first, last time.Time
+	untimed := 0
+	for _, c := range comments {
+		if c.Time == 0 {
+			untimed++
+			continue
+		}
+		posted := time.Unix(c.Time, 0).UTC()
+		if first.IsZero() || posted.Before(first) {
+			first = posted
+		}
+		if posted.After(last) {
+			last = posted
+		}
+		counts[histogramLabel(posted, period)]++
+	}
+
+	switch {
+	case period == histogramHour:
+		for hour := 0; hour < 24; hour++ {
+			labels = append(labels, fmt.Sprintf("%02d:00", hour))
+		}
+	case !first.IsZero():
+		first = time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, time.UTC)
+		for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+			labels = append(labels, histogramLabel(day, period))
+		}
+	}
+
+	max := 0
+	for _, count := range counts {
+		if count > max {
+			max = count
+		}
+	}
+	for _, label := range labels {
+		bar := 0
+		if max > 0 {
+			bar = counts[label] * histogramBarWidth / max
+		}
+		_, err := fmt.Fprintf(w, "%s | %s %d\n", label, strings.Repeat("#", bar), counts[label])
+		if err != nil {
+			return err
+		}
+	}
+	if untimed > 0 {
+		_, err := fmt.Fprintf(w, "%d comments have no time, refetch them with -noCache to include them\n", untimed)
+		return err
+	}
+	return nil
+}
+
+func histogramLabel(t time.Time, period string) string {
+	if period == histogramHour {
+		return t.Format("15") + ":00"
+	}
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	paragraphPattern = regexp.MustCompile(`(?i)<p>`)
+	tagPattern       = regexp.MustCompile(`<[^>]*>`)
+	linkPattern      = regexp.MustCompile(`(?is)<a\s[^>]*href="([^"]*)"[^>]*>(.*?)</a>`)
+)
+
+//How stripHTML renders links, see -linkStyle
+const (
+	linkText     = "text"
+	linkTextURL  = "text-url"
+	linkURL      = "url"
+	linkMarkdown = "markdown"
+)
+
+func validateLinkStyle(style string) error {
+	switch style {
+	case linkText, linkTextURL, linkURL, linkMarkdown:
+		return nil
+	}
+	return fmt.Errorf("unknown -linkStyle %q, expected text, text-url, url or markdown", style)
+}
+
+//Converts the HTML of a comment to plain text. HN separates paragraphs with <p> and otherwise
+//only uses a handful of inline tags, so tags are dropped and paragraphs become blank lines. Links
+//are rendered in linkStyle, just their text with linkText or no style
+func stripHTML(text string, linkStyle string) string {
+	if linkStyle != linkText && linkStyle != "" {
+		text = linkPattern.ReplaceAllStringFunc(text, func(link string) string {
+			match := linkPattern.FindStringSubmatch(link)
+			return renderLink(tagPattern.ReplaceAllString(match[2], ""), match[1], linkStyle)
+		})
+	}
+	text = paragraphPattern.ReplaceAllString(text, "\n\n")
+	text = tagPattern.ReplaceAllString(text, "")
+	return strings.TrimSpace(html.UnescapeString(text))
+}
+
+//Renders a link with its text and url in style. HN uses the url as the text of links, so that's
+//not repeated when they're the same
+func renderLink(text, url, style string) string {
+	switch style {
+	case linkURL:
+		return url
+	case linkMarkdown:
+		return "[" + text + "](" + url + ")"
+	default:
+		if text == url || text == "" {
+			return url
+		}
+		return text + " (" + url + ")"
+	}
+}
+
+//Returns the comments that have text left after stripping their HTML and whitespace
+func compactComments(comments []hnComment) []hnComment {
+	compacted := make([]hnComment, 0, len(comments))
+	for _, c := range comments {
+		if stripHTML(c.Text, linkText) != "" {
+			compacted = append(compacted, c)
+		}
+	}
+	return compacted
+}
+
+//Keeps comments with at least n whitespace-separated words once their HTML is stripped. A link
+//counts as one word however long it is
+func filterMinWords(n int) filterFunction {
+	return func(c *hnComment) bool {
+		return len(strings.Fields(stripHTML(c.Text, linkText))) >= n
+	}
+}
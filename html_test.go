@@ -0,0 +1,24 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompactComments(t *testing.T) {
+	comments := []hnComment{
+		{ID: 1, Text: "Acme | Go | Remote"},
+		//Only tags, e.g. a link that was removed
+		{ID: 2, Text: `<p><a href="https:&#x2F;&#x2F;acme.com"></a><p>`},
+		{ID: 3, Text: "  \n\t "},
+		{ID: 4, Text: ""},
+		{ID: 5, Text: "<i>Beta</i>"},
+	}
+	var ids []int64
+	for _, c := range compactComments(comments) {
+		ids = append(ids, c.ID)
+	}
+	if want := []int64{1, 5}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("kept %v, want %v", ids, want)
+	}
+}
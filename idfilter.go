@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//Reads a set of comment IDs from filename, one per line. Blank lines and everything after a # are
+//ignored
+func readIDFile(filename string) (map[int64]bool, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ids := make(map[int64]bool)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i != -1 {
+			text = text[:i]
+		}
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid comment ID %q", filename, line, text)
+		}
+		ids[id] = true
+	}
+	return ids, scanner.Err()
+}
+
+//Keeps the comments with one of the ids
+func filterIDs(ids map[int64]bool) filterFunction {
+	return func(c *hnComment) bool {
+		return ids[c.ID]
+	}
+}
@@ -0,0 +1,49 @@
+//go:build kafka
+// +build kafka
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+func init() {
+	produceToKafka = produceComments
+}
+
+//Writes comments to config.topic in one synchronous batch. The writer spreads the messages over the
+//topic's partitions concurrently and only returns once every partition leader and its in-sync
+//replicas acknowledged them
+func produceComments(ctx context.Context, config kafkaConfig, comments []hnComment) error {
+	transport := &kafka.Transport{}
+	if config.user != "" {
+		transport.SASL = plain.Mechanism{Username: config.user, Password: config.password}
+	}
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(config.brokers...),
+		Topic:        config.topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		Transport:    transport,
+	}
+	defer writer.Close()
+
+	messages := make([]kafka.Message, 0, len(comments))
+	for _, c := range comments {
+		value, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, kafka.Message{Key: []byte(strconv.FormatInt(c.ID, 10)), Value: value})
+	}
+	if err := writer.WriteMessages(ctx, messages...); err != nil {
+		return fmt.Errorf("producing to Kafka topic %s: %v", config.topic, err)
+	}
+	return nil
+}
@@ -6,232 +6,2271 @@
 
 //Use with npm's prettyjson
 
-//Todo: Add usage here
+//Usage: hn-comment-parser -threadID=<id> [-keywords='remote "machine learning"'] [-outFile=out.json]
+//Keywords are separated by spaces, double quotes group several words into a single phrase
+//Every flag can also be set with an environment variable named HN_ and the flag in upper snake case,
+//e.g. HN_THREAD_ID, HN_KEYWORDS or HN_FORMAT. Flags on the command line take precedence
 //--------------------------------------------------------------------------------------------------------------------
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"html"
+	"io"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"net/http"
 	"os"
 	"os/user"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
 )
 
-const (
-	urlToFormat = "https://hacker-news.firebaseio.com/v0/item/%0.f.json"
-)
+//The base URL of the Firebase HN API, -apiBase
+var apiBase = "https://hacker-news.firebaseio.com/v0"
+
+//Returns the API URL of the item with id
+func itemURL(id int64) string {
+	return fmt.Sprintf("%s/item/%d.json", apiBase, id)
+}
 
 type hnThread struct {
-	Kids []float64 `json:"kids"`
+	By    string  `json:"by"`
+	ID    int64   `json:"id"`
+	Kids  []int64 `json:"kids"`
+	Text  string  `json:"text"`
+	Title string  `json:"title"`
+	Time  int64   `json:"time"`
+	//The link of a link post
+	URL   string `json:"url"`
+	Score int    `json:"score"`
+	//The number of comments in the thread, including replies
+	Descendants int `json:"descendants"`
+}
+
+//Returns the story itself as a comment so it can be output alongside its comments. Stories
+//without text, like link posts, use their title
+func (t *hnThread) rootComment() hnComment {
+	text := html.UnescapeString(t.Text)
+	if text == "" {
+		text = t.Title
+	}
+	return hnComment{By: t.By, ID: t.ID, Text: text, Time: t.Time}
 }
 
 type hnComment struct {
-	By     string  `json:"by"`
-	ID     float64 `json:"id"`
-	Parent float64 `json:"parent"`
-	Text   string  `json:"text"`
+	By     string `json:"by"`
+	ID     int64  `json:"id"`
+	Parent int64  `json:"parent"`
+	Text   string `json:"text"`
+	//Unix time the comment was posted, unset in caches written before it was kept
+	Time int64 `json:"time,omitempty"`
+	//Time rendered with -date-format
+	CreatedAt string `json:"createdAt,omitempty"`
+	Deleted   bool   `json:"deleted,omitempty"`
+	//Whether the comment was written by the author of the thread, only set when fetching a thread
+	IsOP bool `json:"isOP,omitempty"`
+	//The IDs of the replies, as returned by the API
+	Kids []int64 `json:"kids,omitempty"`
+	//How well the comment ranked, only set with -rankBy
+	Score *float64 `json:"score,omitempty"`
+
+	//The keywords found in Text, only set with -annotateMatches
+	Matched []string `json:"matched,omitempty"`
+
+	//Extracted from Text, only set with -extract
+	Links   []string `json:"links,omitempty"`
+	Emails  []string `json:"emails,omitempty"`
+	Company string   `json:"company,omitempty"`
+	Remote  string   `json:"remote,omitempty"`
+	Salary  string   `json:"salary,omitempty"`
+
+	EmploymentTypes []string `json:"employmentTypes,omitempty"`
+	Seniority       []string `json:"seniority,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
+
+	Contacts *contacts `json:"contacts,omitempty"`
+
+	//The fields of the header line of a posting, only set with -parseHeader
+	Header *postingHeader `json:"header,omitempty"`
+
+	//Text translated to the -translateTo language
+	Translation string `json:"translation,omitempty"`
+
+	//The number of replies among the fetched comments, only set with -replyCounts. Replies that
+	//weren't fetched, e.g. all of them when only top-level comments are fetched, aren't counted
+	ReplyCount *int `json:"replyCount,omitempty"`
+
+	//The karma of the author, only set with -withAuthorInfo
+	AuthorKarma *int `json:"authorKarma,omitempty"`
+
+	//The comments this one replies to, closest first. Only set with -withParent
+	Ancestors []ancestor `json:"ancestors,omitempty"`
+}
+
+//Reports whether a comment should be kept. Filters may annotate the comment they're given
+type filterFunction func(*hnComment) bool
+
+//Keeps comments that pass every filter
+func allOf(filters ...filterFunction) filterFunction {
+	return func(c *hnComment) bool {
+		for _, filter := range filters {
+			if !filter(c) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+//Describes a response body that decoded to something other than a JSON object. Some endpoints
+//(e.g. /v0/maxitem.json) return a bare number or string and deleted items come back as null.
+type unexpectedShapeError struct {
+	URL  string
+	Kind string
+}
+
+func (e *unexpectedShapeError) Error() string {
+	return fmt.Sprintf("expected a JSON object from %s, got %s", e.URL, e.Kind)
+}
+
+//Returns the kind of the first JSON value in body: object, array, string, number, bool or null
+func jsonKind(body []byte) (string, error) {
+	token, err := json.NewDecoder(bytes.NewReader(body)).Token()
+	if err != nil {
+		return "", err
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '{' {
+			return "object", nil
+		}
+		return "array", nil
+	case string:
+		return "string", nil
+	case float64:
+		return "number", nil
+	case bool:
+		return "bool", nil
+	default:
+		return "null", nil
+	}
 }
 
-type filterFunction func(string) bool
+//Fetches url and returns the raw response body
+func fetchBody(ctx context.Context, url string) ([]byte, error) {
+	_, body, err := fetchResponse(ctx, url, nil)
+	return body, err
+}
+
+//Fetches url with the extra request header and returns the response, whose body is already
+//read and closed, along with the body. Use fetchResponse to fail over to the -apiMirrors
+func fetchOnce(ctx context.Context, url string, header http.Header) (response *http.Response, body []byte, err error) {
+	defer func(start time.Time) {
+		metrics.fetched(time.Since(start), err)
+	}(time.Now())
 
-//Fetches contents of a single comment and filters it if any keywords are given based on those
-//keywords. If the comment contains these keywords it will be sent to the centralProcess. If no
-//keywords are provided all comments are sent to the centralProcess
-func getComment(ch chan hnComment, url string) {
-	response, err := http.Get(url)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	request.Header.Set("Accept-Encoding", acceptEncoding)
+	response, err = httpClient.Do(request)
 	if err != nil {
-		log.Fatalln(err.Error())
+		return nil, nil, err
 	}
 	defer response.Body.Close()
+	logProtocol(response)
+
+	//A 304 Not Modified has no body to decode
+	if response.StatusCode == http.StatusNotModified {
+		return response, nil, nil
+	}
+	decoded, err := decodedBody(response)
+	if err != nil {
+		return response, nil, fmt.Errorf("decoding %s: %v", url, err)
+	}
+	defer decoded.Close()
+	body, err = ioutil.ReadAll(decoded)
+	return response, body, err
+}
+
+//An error the API reported in the body of a successful response, like {"error": "..."}, which
+//Firebase sends when it's rate limiting or overloaded
+type errorBodyError struct {
+	URL     string
+	Message string
+}
+
+func (e *errorBodyError) Error() string {
+	return fmt.Sprintf("%s returned an error: %s", e.URL, e.Message)
+}
+
+//Returns an *errorBodyError if body is an error object rather than an item: an object with an
+//error field and no id
+func errorFromBody(url string, body []byte) error {
+	var fields struct {
+		ID    json.RawMessage `json:"id"`
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &fields) != nil || fields.Error == nil || fields.ID != nil {
+		return nil
+	}
+	message := string(fields.Error)
+	var s string
+	if json.Unmarshal(fields.Error, &s) == nil {
+		message = s
+	}
+	return &errorBodyError{URL: url, Message: message}
+}
+
+//How often fetchObject retries a response with an error body
+const errorBodyRetries = 2
+
+//The wait before the first retry of a response with an error body, doubled on every retry after it.
+//A var so tests don't wait
+var errorBodyBackoff = 500 * time.Millisecond
+
+//Fetches url and decodes it into v, returning the undecoded body as well. Returns an
+//*unexpectedShapeError instead of a decode error if the body isn't a JSON object. Responses with
+//an error body are retried and an *errorBodyError is returned if they keep failing
+func fetchObject(ctx context.Context, url string, v interface{}) ([]byte, error) {
+	backoff := errorBodyBackoff
+	for attempt := 0; ; attempt++ {
+		body, err := fetchBody(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		err = decodeObject(url, body, v)
+		var bodyErr *errorBodyError
+		if !errors.As(err, &bodyErr) || attempt >= errorBodyRetries {
+			return body, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
 
-	bytes, err := ioutil.ReadAll(response.Body)
+//Decodes the body fetched from url into v, see fetchObject
+func decodeObject(url string, body []byte, v interface{}) error {
+	kind, err := jsonKind(body)
 	if err != nil {
-		log.Fatalln(err.Error())
+		return fmt.Errorf("decoding %s: %v", url, err)
+	}
+	if kind != "object" {
+		return &unexpectedShapeError{URL: url, Kind: kind}
+	}
+	if err := errorFromBody(url, body); err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+//The outcome of fetching a single comment. err is set if the comment couldn't be fetched or
+//decoded, in which case comment is the zero value
+type fetchResult struct {
+	ID      int64
+	comment hnComment
+	//The response body as returned by the API, unset for comments read from the comment cache
+	raw json.RawMessage
+	err error
+	//Set if the comment failed before its request was sent
+	skipped bool
+}
+
+//Fetches contents of a single comment and sends it to the centralProcess. Failures are sent
+//along as well so the centralProcess can account for every comment it launched a worker for
+func getComment(ctx context.Context, ch chan fetchResult, id int64, cache *commentCache) {
+	if cache != nil {
+		if hnComm, ok := cache.get(id); ok {
+			ch <- fetchResult{ID: id, comment: hnComm}
+			return
+		}
 	}
 
+	url := itemURL(id)
 	hnComm := hnComment{}
-	err = json.Unmarshal(bytes, &hnComm)
+	raw, err := fetchObject(ctx, url, &hnComm)
 	if err != nil {
-		log.Fatalln(err)
+		ch <- fetchResult{ID: id, err: err}
+		return
 	}
 
 	unescapedText := html.UnescapeString(string(hnComm.Text))
 	hnComm.Text = unescapedText
-	ch <- hnComm
+	if cache != nil {
+		cache.put(hnComm)
+	}
+	ch <- fetchResult{ID: id, comment: hnComm, raw: raw}
 }
 
 // Fetches all of the comments in a thread
-func getThreadFromAPI(url string) *hnThread {
-	response, err := http.Get(url)
-	if err != nil {
-		log.Fatalln(err.Error())
+func getThreadFromAPI(ctx context.Context, url string) (*hnThread, error) {
+	hnThread, _, err := getThreadWithValidators(ctx, url)
+	return hnThread, err
+}
+
+//Options for fetchFromAPI
+type fetchOptions struct {
+	onComment func(hnComment)
+	onRaw     func(json.RawMessage)
+	onError   func(id int64, err error)
+	progress  *os.File
+	cache     *commentCache
+	//The API fetchFromAPI fetches threads from, firebase if empty
+	backend string
+	//Called with the validators of the thread item response when fetching from firebase
+	onValidators func(cacheValidators)
+	//How often fetching the thread item is retried
+	threadRetries int
+	//How many levels of replies fetchFromAPI fetches and how many replies of each comment it
+	//follows, see withDepth
+	depth       int
+	maxChildren int
+	//How many comments fetchComments requests per second, 0 for as many as it can
+	rps float64
+	//Comments fetchFromAPI doesn't fetch again, see withKnownComments
+	known map[int64]hnComment
+	//How long fetchComments takes to reach full concurrency, see withRamp
+	ramp time.Duration
+
+	checkpointEvery int
+	onCheckpoint    func([]hnComment)
+}
+
+type fetchOption func(*fetchOptions)
+
+//Registers a callback that's invoked on every fetched comment before any filtering is applied.
+//The callback is called from the collecting goroutine, one comment at a time, so it doesn't have
+//to be safe for concurrent use. It blocks collection while it runs so it should return quickly.
+//If several callbacks are registered they're called in order
+func withOnComment(f func(hnComment)) fetchOption {
+	return func(o *fetchOptions) {
+		prev := o.onComment
+		o.onComment = func(c hnComment) {
+			if prev != nil {
+				prev(c)
+			}
+			f(c)
+		}
 	}
-	defer response.Body.Close()
+}
 
-	bytes, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		log.Fatalln(err.Error())
+//Registers a callback that's invoked with the unparsed API response of every fetched comment.
+//Comments read from the comment cache have no response and are skipped. Like the withOnComment
+//callbacks it's called from the collecting goroutine
+func withOnRaw(f func(json.RawMessage)) fetchOption {
+	return func(o *fetchOptions) {
+		o.onRaw = f
 	}
+}
 
-	hnThread := &hnThread{}
-	err = json.Unmarshal(bytes, hnThread)
-	if err != nil {
-		log.Fatalln(err.Error())
+//Registers a callback that's invoked for every comment that couldn't be fetched. Like the
+//withOnComment callbacks it's called from the collecting goroutine
+func withOnError(f func(id int64, err error)) fetchOption {
+	return func(o *fetchOptions) {
+		prev := o.onError
+		o.onError = func(id int64, err error) {
+			if prev != nil {
+				prev(id, err)
+			}
+			f(id, err)
+		}
 	}
+}
 
-	return hnThread
+//Caches each fetched comment in its own file in dir and reads comments from there before
+//fetching them, unless they were cached longer than ttl ago
+func withCommentCache(dir string, ttl time.Duration) fetchOption {
+	return func(o *fetchOptions) {
+		o.cache = &commentCache{dir: dir, ttl: ttl}
+	}
 }
 
-func fetchFromAPI(threadID float64) []hnComment {
+//Registers a callback that's invoked with the comments fetched so far after every n comments,
+//e.g. to save partial results during a long fetch. Like the withOnComment callbacks it's called
+//from the collecting goroutine
+func withCheckpoint(n int, f func([]hnComment)) fetchOption {
+	return func(o *fetchOptions) {
+		o.checkpointEvery = n
+		o.onCheckpoint = f
+	}
+}
 
-	threadURL := fmt.Sprintf(urlToFormat, threadID)
-	thread := getThreadFromAPI(threadURL)
+//Fetches threads from backend. With algolia the whole thread is fetched in one request, falling
+//back to fetching each comment from the Firebase API if that fails
+func withBackend(backend string) fetchOption {
+	return func(o *fetchOptions) {
+		o.backend = backend
+	}
+}
 
-	//WaitGroup to know when all the worker processes finish
-	//Channel to communicate between the central process that fetches all the data and the worker processes
-	hnCommentChan := make(chan hnComment)
+//Registers a callback that's invoked with the validators of the thread item response, so the
+//thread can be revalidated later. It isn't called when the thread is fetched from algolia
+func withOnValidators(f func(cacheValidators)) fetchOption {
+	return func(o *fetchOptions) {
+		o.onValidators = f
+	}
+}
 
-	//Iterate over all comments found and launch a goroutine to fetch it's content
-	for _, id := range thread.Kids {
-		commentURL := fmt.Sprintf(urlToFormat, id)
-		go getComment(hnCommentChan, commentURL)
+//Retries fetching the thread item up to n times. It's retried harder than comments since
+//nothing can be fetched without it
+func withThreadRetries(n int) fetchOption {
+	return func(o *fetchOptions) {
+		o.threadRetries = n
+	}
+}
+
+//Fetches depth levels of a thread, 1 for only the top level comments and 0 for all of them. Of
+//each comment at most maxChildren replies are followed, 0 follows all of them. Top level comments
+//are always all fetched
+func withDepth(depth, maxChildren int) fetchOption {
+	return func(o *fetchOptions) {
+		o.depth = depth
+		o.maxChildren = maxChildren
+	}
+}
+
+//Makes fetchFromAPI reuse comments instead of fetching them again, so only comments that were
+//added since they were fetched are requested. Replies added to the reused comments since aren't
+//found, as the reused comments' kids are used to find the next level
+func withKnownComments(comments []hnComment) fetchOption {
+	return func(o *fetchOptions) {
+		o.known = make(map[int64]hnComment, len(comments))
+		for _, c := range comments {
+			o.known[c.ID] = c
+		}
+	}
+}
+
+//Limits fetching comments to rps requests per second, 0 doesn't limit it. The last one applies,
+//so a thread's own limit can override a global one
+func withRateLimit(rps float64) fetchOption {
+	return func(o *fetchOptions) {
+		o.rps = rps
+	}
+}
+
+//Starts fetchComments with one request in flight and lets the number grow evenly to all of them
+//over period, to avoid a burst of requests at the start. 0 starts them all at once
+func withRamp(period time.Duration) fetchOption {
+	return func(o *fetchOptions) {
+		o.ramp = period
+	}
+}
+
+//Reports the progress of fetching comments to w
+func withProgress(w *os.File) fetchOption {
+	return func(o *fetchOptions) {
+		o.progress = w
+	}
+}
+
+func fetchFromAPI(ctx context.Context, threadID int64, opts ...fetchOption) ([]hnComment, error) {
+	options := fetchOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.backend == backendAlgolia {
+		comments, err := fetchFromAlgolia(ctx, threadID, options)
+		if err == nil || ctx.Err() != nil {
+			return comments, err
+		}
+		log.Printf("Fetching thread %d from Algolia failed, falling back to the Firebase API: %v", threadID, err)
+	}
+
+	threadURL := itemURL(threadID)
+	thread, validators, err := getThreadWithRetries(ctx, threadURL, options.threadRetries)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch thread %d, so none of its comments can be fetched: %w", threadID, err)
+	}
+	if options.onValidators != nil {
+		options.onValidators(validators)
 	}
 
+	//Each level is fetched like the top level, a request per comment all at once, so maxChildren
+	//bounds how many requests are in flight as well as how many are sent
 	var comments []hnComment
-	for i := 0; i < len(thread.Kids); i++ {
-		c := <-hnCommentChan
-		comments = append(comments, c)
+	//Checkpoint the comments of every level so far rather than only the level being fetched
+	if options.onCheckpoint != nil && options.checkpointEvery > 0 {
+		opts = append(append([]fetchOption{}, opts...), withCheckpoint(1, func(level []hnComment) {
+			if (len(comments)+len(level))%options.checkpointEvery == 0 {
+				options.onCheckpoint(append(append([]hnComment{}, comments...), level...))
+			}
+		}))
+	}
+	ids := thread.Kids
+	reused := 0
+	for level := 1; len(ids) > 0; level++ {
+		var fetched []hnComment
+		if options.known != nil {
+			var fetchIDs []int64
+			for _, id := range ids {
+				if _, ok := options.known[id]; !ok {
+					fetchIDs = append(fetchIDs, id)
+				}
+			}
+			fetched = reuseKnown(ids, options.known, fetchComments(ctx, fetchIDs, opts...))
+			reused += len(ids) - len(fetchIDs)
+		} else {
+			fetched = fetchComments(ctx, ids, opts...)
+		}
+		comments = append(comments, fetched...)
+		if options.depth > 0 && level >= options.depth {
+			break
+		}
+		ids = nil
+		for _, c := range fetched {
+			ids = append(ids, followedKids(c.Kids, options.maxChildren)...)
+		}
+	}
+	if options.known != nil {
+		log.Printf("Reused %d cached comments and fetched %d new ones", reused, len(comments)-reused)
+	}
+	markOP(comments, thread.By)
+	return comments, nil
+}
+
+//Returns the comments with ids in order, the known ones from known and the others from fetched.
+//IDs that are in neither, e.g. because they failed to fetch, are left out
+func reuseKnown(ids []int64, known map[int64]hnComment, fetched []hnComment) []hnComment {
+	byID := make(map[int64]hnComment, len(fetched))
+	for _, c := range fetched {
+		byID[c.ID] = c
+	}
+	comments := make([]hnComment, 0, len(ids))
+	for _, id := range ids {
+		if c, ok := known[id]; ok {
+			comments = append(comments, c)
+		} else if c, ok := byID[id]; ok {
+			comments = append(comments, c)
+		}
 	}
 	return comments
 }
 
-func fetchFromFile(file *os.File) ([]hnComment, error) {
-	var hnComments []hnComment
-	err := json.NewDecoder(file).Decode(&hnComments)
-	if err != nil {
-		return nil, err
+//Returns the first maxChildren of kids, all of them if maxChildren is 0
+func followedKids(kids []int64, maxChildren int) []int64 {
+	if maxChildren > 0 && len(kids) > maxChildren {
+		return kids[:maxChildren]
 	}
-	return hnComments, nil
+	return kids
 }
 
-func filterTextFromKeywords(keywords []string) filterFunction {
-	return func(text string) bool {
-		lowerText := strings.ToLower(text)
-		for _, keyword := range keywords {
-			if strings.Contains(lowerText, keyword) {
-				return true
+//Sets IsOP on the comments written by op, the author of their thread
+func markOP(comments []hnComment, op string) {
+	if op == "" {
+		return
+	}
+	for i := range comments {
+		comments[i].IsOP = comments[i].By == op
+	}
+}
+
+//Fetches the comments with the given ids concurrently. Comments that fail to fetch are logged
+//and left out
+func fetchComments(ctx context.Context, ids []int64, opts ...fetchOption) []hnComment {
+	options := fetchOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	//Channel to communicate between the central process that fetches all the data and the worker processes
+	hnCommentChan := make(chan fetchResult)
+
+	var p *progress
+	if options.progress != nil {
+		p = newProgress(len(ids), options.progress)
+		defer p.Stop()
+	}
+
+	limiter := newRateLimiter(options.rps)
+	defer limiter.Stop()
+	rampCtx, stopRamp := context.WithCancel(ctx)
+	defer stopRamp()
+	warmUp := newRamp(rampCtx, len(ids), options.ramp)
+
+	//Iterate over all comments found and launch a goroutine to fetch it's content
+	for _, id := range ids {
+		go func(id int64) {
+			if err := warmUp.acquire(ctx); err != nil {
+				hnCommentChan <- fetchResult{ID: id, err: err, skipped: true}
+				return
+			}
+			defer warmUp.release()
+			if err := limiter.wait(ctx); err != nil {
+				hnCommentChan <- fetchResult{ID: id, err: err, skipped: true}
+				return
 			}
+			if p != nil {
+				p.requestStarted()
+			}
+			getComment(ctx, hnCommentChan, id, options.cache)
+		}(id)
+	}
+
+	var comments []hnComment
+	for i := 0; i < len(ids); i++ {
+		r := <-hnCommentChan
+		if p != nil && r.skipped {
+			p.requestSkipped(r.err)
+		} else if p != nil {
+			p.requestFinished(r.err)
 		}
-		return false
+		if r.err != nil {
+			//Once the context is done every remaining comment fails the same way
+			if ctx.Err() == nil {
+				log.Printf("Skipping comment %d: %v", r.ID, r.err)
+			}
+			if options.onError != nil {
+				options.onError(r.ID, r.err)
+			}
+			continue
+		}
+		if options.onComment != nil {
+			options.onComment(r.comment)
+		}
+		if options.onRaw != nil && r.raw != nil {
+			options.onRaw(r.raw)
+		}
+		comments = append(comments, r.comment)
+		if options.onCheckpoint != nil && options.checkpointEvery > 0 && len(comments)%options.checkpointEvery == 0 {
+			options.onCheckpoint(comments)
+		}
+	}
+	if ctx.Err() != nil {
+		log.Printf("Stopped fetching (%v), got %d of %d comments", ctx.Err(), len(comments), len(ids))
 	}
+	return comments
 }
 
-func fatalnWrapper(err error) {
+//Parses a comma-separated list of comment IDs
+func parseCommentIDs(s string) ([]int64, error) {
+	var ids []int64
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid comment ID %q", field)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+//A comment that couldn't be fetched, or with -explain was skipped, as written to the -errorReport
+//file. Reason is one of the reason codes in skip.go
+type fetchFailure struct {
+	ID     int64  `json:"id"`
+	Reason string `json:"reason"`
+	Error  string `json:"error,omitempty"`
+}
+
+func writeErrorReport(filename string, failures []fetchFailure) error {
+	file, err := os.Create(filename)
 	if err != nil {
-		log.Fatalln(err)
+		return err
+	}
+	defer file.Close()
+
+	if failures == nil {
+		failures = []fetchFailure{}
 	}
+	return json.NewEncoder(file).Encode(failures)
 }
 
-func fileExists(filename string) bool {
-	_, err := os.Stat(filename)
+//Reads the IDs of the comments that couldn't be fetched from a file written by -errorReport.
+//Comments that were skipped for other reasons are left out
+func readFailures(filename string) ([]int64, error) {
+	file, err := os.Open(filename)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return false
+		return nil, err
+	}
+	defer file.Close()
+
+	var failures []fetchFailure
+	if err := json.NewDecoder(file).Decode(&failures); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", filename, err)
+	}
+	var ids []int64
+	for _, f := range failures {
+		//Reports written before reasons were added only list fetch errors
+		if f.Reason == reasonFetchError || f.Reason == "" {
+			ids = append(ids, f.ID)
+		}
+	}
+	return ids, nil
+}
+
+//Merges fetched into comments, replacing comments with the same ID and appending new ones
+func mergeComments(comments, fetched []hnComment) []hnComment {
+	index := make(map[int64]int, len(comments))
+	for i, c := range comments {
+		index[c.ID] = i
+	}
+	for _, c := range fetched {
+		if i, ok := index[c.ID]; ok {
+			comments[i] = c
 		} else {
-			fatalnWrapper(err)
+			index[c.ID] = len(comments)
+			comments = append(comments, c)
 		}
 	}
-	return true
+	return comments
 }
 
-func getComments(threadID int) []hnComment {
-	var comments []hnComment
-	var err error
-	var cachedFile *os.File
-	defer cachedFile.Close()
+//Re-fetches the comments listed in failuresFile and merges the ones that succeed into the cache of
+//threadID, the file and format of policy. Returns the merged comments. Comments that still fail are
+//logged and reported to any onError callback in opts
+func retryFailures(ctx context.Context, failuresFile string, threadID int, policy cachePolicy, opts ...fetchOption) ([]hnComment, error) {
+	ids, err := readFailures(failuresFile)
+	if err != nil {
+		return nil, err
+	}
 
-	//This dir is located at ~/
-	usr, err := user.Current()
-	fatalnWrapper(err)
-	defaultDir := usr.HomeDir + "/" + ".cache/hn-article-parser"
-	cachedFileName := defaultDir + "/" + strconv.Itoa(threadID) + ".json"
+	var stillFailing []string
+	opts = append(opts, withOnError(func(id int64, err error) {
+		stillFailing = append(stillFailing, strconv.FormatInt(id, 10))
+	}))
+	fetched := fetchComments(ctx, ids, opts...)
+	log.Printf("Retried %d comments, %d succeeded", len(ids), len(fetched))
+	if len(stillFailing) > 0 {
+		log.Println("Still failing:", strings.Join(stillFailing, ","))
+	}
 
-	//If the file exists, read from it otherwise fetch all hncomments and store them
+	var comments []hnComment
+	cachedFileName := policy.cacheFile(threadID)
 	if fileExists(cachedFileName) {
-		log.Println("Reading cached comments from", cachedFileName)
-		cachedFile, err = os.Open(cachedFileName)
-		fatalnWrapper(err)
-		comments, err = fetchFromFile(cachedFile)
-		fatalnWrapper(err)
-	} else {
-		log.Println(fmt.Sprintf("Cachefile %s not found, attempting to fetch threadID: %d",
-			cachedFileName, threadID))
-
-		if !fileExists(defaultDir) {
-			err := os.MkdirAll(defaultDir, 0777)
-			fatalnWrapper(err)
+		if comments, err = readCommentsFile(cachedFileName); err != nil {
+			return nil, err
 		}
-		cachedFile, err = os.Create(cachedFileName)
-		fatalnWrapper(err)
+	}
+	comments = mergeComments(comments, fetched)
 
-		comments = fetchFromAPI(float64(threadID))
-		err = json.NewEncoder(cachedFile).Encode(comments)
-		fatalnWrapper(err)
+	if err := os.MkdirAll(cacheDir(), 0777); err != nil {
+		return nil, err
 	}
+	return comments, writeCommentsAtomic(cachedFileName, comments, policy.format)
+}
 
-	return comments
+//Reads the comments in r, either a JSON array or one JSON object per line, whichever r starts with
+func fetchFromFile(r io.Reader) ([]hnComment, error) {
+	reader := bufio.NewReader(r)
+	array, err := startsWithArray(reader)
+	if err != nil {
+		return nil, err
+	}
+	var hnComments []hnComment
+	decoder := json.NewDecoder(reader)
+	if array {
+		if err := decoder.Decode(&hnComments); err != nil {
+			return nil, err
+		}
+		return hnComments, nil
+	}
+	for decoder.More() {
+		var c hnComment
+		if err := decoder.Decode(&c); err != nil {
+			return nil, err
+		}
+		hnComments = append(hnComments, c)
+	}
+	return hnComments, nil
 }
 
-func main() {
-	threadID := flag.Int("threadID", 0, "The ID of the HN thread we will use")
-	outFileName := flag.String("outFile", "", "Write comments to this file. Defaults to stdout")
-	keywordsStr := flag.String("keywords", "",
-		"The keywords to filter comments on. Usage -keywords=\"keyword1 keyword2 keyword3\"")
-	flag.Parse()
+//Reads previously exported comments from filename. Files ending in .csv are parsed as CSV,
+//everything else as the JSON array written by the cache and the default output
+func readCommentsFile(filename string) ([]hnComment, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
 
-	comments := getComments(*threadID)
+	if strings.EqualFold(filepath.Ext(filename), ".csv") {
+		return fetchFromCSV(file)
+	}
+	return fetchFromFile(file)
+}
 
-	//If we have no keywords, pipe all to the outfile. Otherwise filter by keywords
-	var filter filterFunction
-	if len(*keywordsStr) == 0 {
-		filter = func(text string) bool {
-			return true
+//Splits a -keywords value into lowercase keywords. Keywords are separated by whitespace, except
+//inside double quotes which group words into a phrase that has to occur contiguously, e.g.
+//`"machine learning" golang` yields the keywords "machine learning" and "golang". An unterminated
+//quote extends to the end of the value, empty quotes are ignored and repeated keywords are dropped
+func parseKeywords(s string) []string {
+	var keywords []string
+	var current strings.Builder
+	seen := make(map[string]bool)
+	inQuotes := false
+	flush := func() {
+		keyword := strings.ToLower(current.String())
+		current.Reset()
+		if keyword != "" && !seen[keyword] {
+			keywords = append(keywords, keyword)
+			seen[keyword] = true
 		}
-	} else {
-		filter = filterTextFromKeywords(strings.Split(*keywordsStr, " "))
 	}
-
-	filteredComments := make([]hnComment, 0)
-	for _, c := range comments {
-		if filter(c.Text) {
-			filteredComments = append(filteredComments, c)
+	for _, r := range s {
+		switch {
+		case r == '"':
+			flush()
+			inQuotes = !inQuotes
+		case unicode.IsSpace(r) && !inQuotes:
+			flush()
+		default:
+			current.WriteRune(r)
 		}
 	}
+	flush()
+	return keywords
+}
 
-	//Write json to our outfile if we have any filtered comments
-	if len(filteredComments) > 0 {
-		//The output file to write the filtered comments to, defaults to stdout
-		var outFile *os.File
-		if *outFileName == "" {
-			log.Println("No outfile specified, defaulting to stdout")
-			outFile = os.Stdout
-		} else {
-			var err error
-			outFile, err = os.Create(*outFileName)
-			fatalnWrapper(err)
-		}
-		defer outFile.Close()
-		if err := json.NewEncoder(outFile).Encode(filteredComments); err != nil {
-			log.Fatalln(err)
+//Returns the byte offsets of the earliest keyword occurrence in the lowercased text, or -1, -1
+//if none of the keywords occur
+func findKeyword(lowerText string, keywords []string) (int, int) {
+	start, end := -1, -1
+	for _, keyword := range keywords {
+		i := strings.Index(lowerText, keyword)
+		if i != -1 && (start == -1 || i < start) {
+			start, end = i, i+len(keyword)
 		}
-	} else {
-		log.Println("No results found based on the keywords supplied. Not writing outFile")
+	}
+	return start, end
+}
+
+//How comments are matched against keywords
+type keywordOptions struct {
+	//Record the keywords that occur in the comment's Matched field
+	annotate bool
+	//The number of distinct keywords that have to occur. 1 keeps comments containing any keyword
+	minMatches int
+}
+
+//Returns the minimum number of matches for a -match mode: any, all or a number
+func parseMatchMode(mode string, keywords []string) (int, error) {
+	switch mode {
+	case "any":
+		return 1, nil
+	case "all":
+		return len(keywords), nil
+	}
+	n, err := strconv.Atoi(mode)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid match mode %q, expected any, all or a positive number", mode)
+	}
+	return n, nil
+}
+
+//Counts how many comments a filter is asked about and how many it keeps. Safe for concurrent use
+type matchCounter struct {
+	seen    int64
+	matched int64
+}
+
+//Wraps filter so its calls are counted
+func (m *matchCounter) count(filter filterFunction) filterFunction {
+	return func(c *hnComment) bool {
+		keep := filter(c)
+		atomic.AddInt64(&m.seen, 1)
+		if keep {
+			atomic.AddInt64(&m.matched, 1)
+		}
+		return keep
+	}
+}
+
+//Filters that see fewer comments than this aren't warned about, a few comments all matching is
+//nothing unusual
+const broadMatchMinComments = 10
+
+//Warns if the keywords matched at least threshold percent of the comments, which usually means a
+//keyword is far too common
+func warnIfTooBroad(m *matchCounter, threshold float64) {
+	if threshold <= 0 || m.seen < broadMatchMinComments {
+		return
+	}
+	percent := float64(m.matched) * 100 / float64(m.seen)
+	if percent >= threshold {
+		log.Printf("Warning: the keywords matched %.1f%% of %d comments, the filter may be too broad. "+
+			"Check for a very common keyword or set -broadMatchWarn 0 to silence this", percent, m.seen)
+	}
+}
+
+//Keeps comments whose text contains at least options.minMatches of the distinct keywords
+func filterTextFromKeywords(keywords []string, options keywordOptions) filterFunction {
+	return filterFieldsFromKeywords(keywords, options, func(c *hnComment) []string {
+		return []string{c.Text}
+	})
+}
+
+//Returns every textual field of c for -keywordsAnyField: the author, the text and the extracted
+//company, remote status, salary, links and emails. Extracted fields are empty without -extract
+func allTextFields(c *hnComment) []string {
+	fields := []string{c.By, c.Text, c.Company, c.Remote, c.Salary}
+	fields = append(fields, c.Links...)
+	return append(fields, c.Emails...)
+}
+
+//Like filterTextFromKeywords but matches the keywords against all the strings returned by fields
+func filterFieldsFromKeywords(keywords []string, options keywordOptions, fields func(*hnComment) []string) filterFunction {
+	return func(c *hnComment) bool {
+		lowerText := strings.ToLower(strings.Join(fields(c), "\n"))
+		if !options.annotate && options.minMatches <= 1 {
+			start, _ := findKeyword(lowerText, keywords)
+			return start != -1
+		}
+
+		var matched []string
+		for _, keyword := range keywords {
+			if strings.Contains(lowerText, keyword) {
+				matched = append(matched, keyword)
+			}
+		}
+		if options.annotate {
+			c.Matched = matched
+		}
+		return len(matched) > 0 && len(matched) >= options.minMatches
+	}
+}
+
+//Uploads body to the S3 location dest (s3://bucket/prefix/) under the object name. Only set when
+//built with the s3 tag so the AWS SDK isn't a dependency of the default build
+var uploadToS3 func(ctx context.Context, dest, name string, body []byte) error
+
+//Returns the S3 object name for an upload of threadID made at t
+func s3ObjectName(threadID int, t time.Time, ext string) string {
+	return fmt.Sprintf("%d-%s%s", threadID, t.UTC().Format("20060102T150405Z"), ext)
+}
+
+//Where -kafka produces comments to and the SASL/PLAIN credentials, if the brokers require them
+type kafkaConfig struct {
+	brokers  []string
+	topic    string
+	user     string
+	password string
+}
+
+//Produces each comment to Kafka as an NDJSON message keyed by its ID, returning once the brokers
+//acknowledged every message. Only set when built with the kafka tag so the Kafka client isn't a
+//dependency of the default build
+var produceToKafka func(ctx context.Context, config kafkaConfig, comments []hnComment) error
+
+//The exit status when -deadline cut fetching short
+const exitTruncated = 3
+
+func fatalnWrapper(err error) {
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false
+		} else {
+			fatalnWrapper(err)
+		}
+	}
+	return true
+}
+
+//The directory threads are cached in, ~/.cache/hn-article-parser if empty. Tests point it at a
+//temporary directory
+var cacheDirOverride string
+
+//Returns the directory threads are cached in. This dir is located at ~/
+func cacheDir() string {
+	if cacheDirOverride != "" {
+		return cacheDirOverride
+	}
+	usr, err := user.Current()
+	fatalnWrapper(err)
+	return usr.HomeDir + "/" + ".cache/hn-article-parser"
+}
+
+//Returns the cache file of a thread
+func threadCacheFile(threadID int) string {
+	return cacheDir() + "/" + strconv.Itoa(threadID) + ".json"
+}
+
+//How getComments uses the thread cache
+type cachePolicy struct {
+	//Caches older than ttl are refetched, 0 never expires them
+	ttl time.Duration
+	//Save the comments fetched so far to <cache file>.partial every flushEvery comments, so a
+	//crash during a long fetch doesn't lose everything. 0 disables it
+	flushEvery int
+	//Never fetch, fail if the cache is missing or has expired
+	offline bool
+	//Ignore the cache and refetch the thread, replacing the cache
+	refresh bool
+	//When reading from the cache, fetch the thread item to warn if it has grown since
+	checkStale bool
+	//Distinguishes caches of the same thread fetched differently, e.g. to another -depth
+	variant string
+	//Fail on a corrupt cache instead of refetching the thread
+	strict bool
+	//How the cache is written, cacheFormatArray or cacheFormatJSONL
+	format string
+	//Fetch only the comments that aren't in the cache yet and add them to it
+	merge bool
+}
+
+//Returns the variant of caches fetched to depth following maxChildren replies, empty for the
+//defaults
+func cacheVariant(depth, maxChildren int) string {
+	if depth == 1 && maxChildren == 0 {
+		return ""
+	}
+	return fmt.Sprintf("depth-%d-children-%d", depth, maxChildren)
+}
+
+//Returns the cache file of a thread for the variant of p
+func (p cachePolicy) cacheFile(threadID int) string {
+	if p.variant == "" {
+		return threadCacheFile(threadID)
+	}
+	return strings.TrimSuffix(threadCacheFile(threadID), ".json") + "." + p.variant + ".json"
+}
+
+//Reports whether the cache file has outlived ttl
+func cacheExpired(cachedFileName string, ttl time.Duration) bool {
+	if ttl <= 0 {
+		return false
+	}
+	info, err := os.Stat(cachedFileName)
+	fatalnWrapper(err)
+	return time.Since(info.ModTime()) > ttl
+}
+
+//Formats of thread cache files for -cacheFormat. fetchFromFile reads both
+const (
+	cacheFormatArray = "array"
+	cacheFormatJSONL = "jsonl"
+)
+
+func validateCacheFormat(format string) error {
+	switch format {
+	case cacheFormatArray, cacheFormatJSONL:
+		return nil
+	}
+	return fmt.Errorf("unknown cache format %q, expected array or jsonl", format)
+}
+
+//Writes v as JSON to a temporary file next to filename and renames it to filename, so readers
+//never see a partially written file
+func writeJSONAtomic(filename string, v interface{}) error {
+	return writeAtomic(filename, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(v)
+	})
+}
+
+//Like writeJSONAtomic but writes comments in a cache format, with jsonl one comment per line
+func writeCommentsAtomic(filename string, comments []hnComment, format string) error {
+	if format != cacheFormatJSONL {
+		return writeJSONAtomic(filename, comments)
+	}
+	return writeAtomic(filename, func(w io.Writer) error {
+		return writeNDJSON(w, comments, outputOptions{})
+	})
+}
+
+//Writes a temporary file next to filename with write and renames it to filename
+func writeAtomic(filename string, write func(io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+//Fetches only the thread item and warns if it has more top level comments than the cached copy.
+//This is one request instead of refetching every comment
+func warnIfThreadGrew(ctx context.Context, threadID int, cached []hnComment) {
+	thread, err := getThreadFromAPI(ctx, itemURL(int64(threadID)))
+	if err != nil {
+		log.Println("Couldn't check whether the cache is stale:", err)
+		return
+	}
+	//Caches of other depths hold replies as well, which the thread's kids don't count
+	cachedCount := 0
+	for _, c := range cached {
+		if c.Parent == int64(threadID) {
+			cachedCount++
+		}
+	}
+	if len(thread.Kids) > cachedCount {
+		log.Printf("Cache has %d top level comments, thread now has %d; use -noCache to refresh",
+			cachedCount, len(thread.Kids))
+	}
+}
+
+func getComments(ctx context.Context, threadID int, policy cachePolicy, opts ...fetchOption) ([]hnComment, commentSource) {
+	var comments []hnComment
+	var err error
+	var cachedFile *os.File
+	defer cachedFile.Close()
+
+	defaultDir := cacheDir()
+	cachedFileName := policy.cacheFile(threadID)
+	source := commentSource{Kind: "api"}
+
+	//If the file exists, read from it otherwise fetch all hncomments and store them
+	cached := fileExists(cachedFileName)
+	stale := cached && (policy.refresh || cacheExpired(cachedFileName, policy.ttl))
+	//An expired cache is still good if the server says the thread hasn't changed since it was written
+	if stale && !policy.refresh && !policy.offline && threadUnchanged(ctx, threadID, policy) {
+		log.Printf("Thread %d hasn't changed since it was cached, keeping the cache", threadID)
+		now := time.Now()
+		if err := os.Chtimes(cachedFileName, now, now); err != nil {
+			log.Println("Couldn't renew the cache:", err)
+		}
+		stale = false
+	}
+	metrics.cacheLookup("thread", cached && !stale)
+	if policy.offline && !cached {
+		log.Fatalf("No cache for thread %d and offline mode forbids fetching", threadID)
+	}
+	if policy.offline && stale {
+		log.Fatalf("Cache for thread %d is stale (older than %s) and offline mode forbids fetching",
+			threadID, policy.ttl)
+	}
+	if cached && !stale {
+		log.Println("Reading cached comments from", cachedFileName)
+		source = commentSource{Kind: "cache", Path: cachedFileName}
+		if info, err := os.Stat(cachedFileName); err == nil {
+			modTime := info.ModTime()
+			source.CachedAt = &modTime
+		}
+		cachedFile, err = os.Open(cachedFileName)
+		fatalnWrapper(err)
+		comments, err = fetchFromFile(cachedFile)
+		//Caches written before writes were atomic can be truncated, refetch those
+		if err != nil {
+			if policy.offline {
+				log.Fatalf("Cache for thread %d is corrupt (%v) and offline mode forbids fetching", threadID, err)
+			}
+			if policy.strict {
+				log.Fatalf("Cache file %s is corrupt (%v), not refetching with -strict-cache", cachedFileName, err)
+			}
+			log.Printf("Warning: cachefile %s is corrupt (%v), attempting to fetch threadID: %d",
+				cachedFileName, err, threadID)
+			stale = true
+			source = commentSource{Kind: "api"}
+		} else if policy.merge && !policy.offline {
+			log.Printf("Fetching the comments of thread %d that aren't in %s yet", threadID, cachedFileName)
+			opts = append(opts, withKnownComments(comments))
+			stale = true
+			source = commentSource{Kind: "api"}
+		} else if policy.checkStale && !policy.offline {
+			warnIfThreadGrew(ctx, threadID, comments)
+		}
+	} else if !cached {
+		log.Println(fmt.Sprintf("Cachefile %s not found, attempting to fetch threadID: %d",
+			cachedFileName, threadID))
+	} else if policy.refresh {
+		log.Println(fmt.Sprintf("Ignoring cachefile %s, attempting to fetch threadID: %d", cachedFileName, threadID))
+	} else {
+		log.Println(fmt.Sprintf("Cachefile %s is older than %s, attempting to fetch threadID: %d",
+			cachedFileName, policy.ttl, threadID))
+	}
+	if !cached || stale {
+		if !fileExists(defaultDir) {
+			err := os.MkdirAll(defaultDir, 0777)
+			fatalnWrapper(err)
+		}
+		partialFileName := cachedFileName + ".partial"
+		if policy.flushEvery > 0 {
+			opts = append(opts, withCheckpoint(policy.flushEvery, func(comments []hnComment) {
+				if err := writeCommentsAtomic(partialFileName, comments, policy.format); err != nil {
+					log.Println("Not saving partial results:", err)
+				}
+			}))
+		}
+
+		var validators cacheValidators
+		opts = append(opts, withOnValidators(func(v cacheValidators) {
+			validators = v
+		}))
+
+		//Write the cache only once everything is fetched so a crash doesn't leave a truncated cache
+		comments, err = fetchFromAPI(ctx, int64(threadID), opts...)
+		if ctx.Err() != nil {
+			log.Printf("Not caching thread %d since fetching it was cut short", threadID)
+			return comments, source
+		}
+		fatalnWrapper(err)
+		err = writeCommentsAtomic(cachedFileName, comments, policy.format)
+		fatalnWrapper(err)
+		if err := writeValidators(policy.validatorsFile(threadID), validators); err != nil {
+			log.Println("Not saving the cache validators:", err)
+		}
+		if policy.flushEvery > 0 {
+			os.Remove(partialFileName)
+		}
+	}
+
+	return comments, source
+}
+
+func main() {
+	threadID := flag.Int("threadID", 0, "The ID of the HN thread we will use")
+	inFileName := flag.String("inFile", "",
+		"Read comments from this JSON or CSV (.csv) file instead of fetching them. Ignores -threadID")
+	outFileName := flag.String("outFile", "", "Write comments to this file. Defaults to stdout")
+	keywordsStr := flag.String("keywords", "",
+		"The keywords to filter comments on, matched case-insensitively. Wrap a phrase in double quotes "+
+			"to match it as a whole. Usage -keywords='keyword1 \"some phrase\" keyword3'")
+	snippetSize := flag.Int("snippet", 0,
+		"Replace each comment's text with the N characters on either side of the first keyword match")
+	annotateMatches := flag.Bool("annotateMatches", false,
+		"Add a matched field to each comment listing the keywords found in it")
+	extractFields := flag.Bool("extract", false,
+		"Add the links, emails, company, remote status, salary, employment types and tags found in each comment")
+	normalizeExtracted := flag.Bool("normalize-extracted", false,
+		"Dedupe and sort extracted links and emails and lowercase emails. "+
+			"By default they're listed in order of appearance")
+	outS3 := flag.String("outS3", "",
+		"Upload the comments to this S3 location, e.g. s3://bucket/prefix/. Requires building with -tags s3")
+	asTree := flag.Bool("tree", false,
+		"Nest replies under their parent comments, with each comment's depth in the tree")
+	filterCmd := flag.String("filter-cmd", "",
+		"Keep only comments for which this shell command exits 0. Each comment's JSON is passed on stdin")
+	filterCmdJobs := flag.Int("filter-cmd-jobs", runtime.NumCPU(),
+		"The maximum number of -filter-cmd processes to run at once")
+	commentIDs := flag.String("commentIDs", "",
+		"Fetch only these comma-separated comment IDs instead of a thread. Bypasses the cache")
+	showProgress := flag.Bool("progress", false,
+		"Show fetch progress on stderr, as a progress bar on a terminal and periodic log lines otherwise")
+	errorReport := flag.String("errorReport", "",
+		"Write the IDs of comments that couldn't be fetched and why to this JSON file")
+	cacheComments := flag.Bool("commentCache", false,
+		"Also cache every comment in its own file so comments are reused across threads, -commentIDs and -withParent")
+	format := flag.String("format", formatJSON,
+		"The output format: json, ndjson for one comment per line, markdown, "+
+			"blob for the plain text of all comments with a permalink header each, "+
+			"rss or atom for a feed with an item per comment, summary-csv for a spreadsheet of the "+
+			"fields -extract finds, a row per comment, or dot for a GraphViz graph of the replies, "+
+			"which needs -depth 0 or more than 1 to fetch them")
+	samplePct := flag.Float64("samplePercent", 0,
+		"Output a random sample of this percentage (0-100] of the filtered comments")
+	seed := flag.Int64("seed", 0, "Seed for -samplePercent to get the same sample every run. 0 picks a random seed")
+	translateTo := flag.String("translateTo", "",
+		"Add a translation of each comment to this language code, e.g. en. Requires -translateURL")
+	translateURL := flag.String("translateURL", "",
+		"The LibreTranslate compatible endpoint used by -translateTo, e.g. https://libretranslate.com/translate")
+	translateKey := flag.String("translateKey", "", "The API key sent to -translateURL")
+	noColor := flag.Bool("noColor", false,
+		"Never use ANSI colors, even on a terminal. Color is also disabled by NO_COLOR, TERM=dumb "+
+			"or when not writing to a terminal")
+	flag.BoolVar(noColor, "no-color", false, "Same as -noColor")
+	compact := flag.Bool("compact", false, "Drop comments that have no text once HTML tags are stripped")
+	minWords := flag.Int("min-words", 0,
+		"Drop comments with fewer than N words once HTML tags are stripped, before -snippet and -truncate "+
+			"shorten them. Links count as one word. Any N of 1 or more implies -compact")
+	retryFailuresFile := flag.String("retry-failures", "",
+		"Re-fetch the comments in this -errorReport file and merge them into the cache of -threadID")
+	rawPassthrough := flag.Bool("rawPassthrough", false,
+		"Fetch -threadID or -commentIDs and write the API responses as they were returned, as a JSON array. "+
+			"Bypasses the caches, filtering and every other output option")
+	metricsAddr := flag.String("metricsAddr", "",
+		"Serve Prometheus metrics for HN fetches and cache lookups at this address, e.g. :9090. There's no server "+
+			"mode, so they're only served until this run exits and there's no requests-served counter. "+
+			"Requires building with -tags prometheus")
+	cacheTTL := flag.Duration("cache-ttl", 0, "Refetch threads whose cache is older than this, e.g. 6h. 0 never expires caches")
+	commentCacheTTL := flag.Duration("commentCacheTTL", 0,
+		"Refetch comments whose -commentCache entry is older than this, independently of -cache-ttl. "+
+			"0 never expires them")
+	offline := flag.Bool("offline", false,
+		"Only read threads from the cache. Fails if the cache is missing or older than -cache-ttl")
+	decodeWorkers := flag.Int("decodeWorkers", 0,
+		"Decode a JSON -inFile element by element and filter it on this many goroutines. 0 decodes it in one go")
+	keywordsAnyField := flag.Bool("keywordsAnyField", false,
+		"Match -keywords against the author, text and, with -extract, the extracted fields instead of just the text")
+	matchMode := flag.String("match", "any",
+		"Keep comments containing any of the -keywords, all of them or at least this many distinct ones")
+	matchMin := flag.Int("match-min", 0,
+		"Keep comments containing at least this many distinct -keywords. Overrides -match")
+	withLinkIndex := flag.Bool("with-link-index", false,
+		"End the markdown report with an index of the unique links and the companies posting them. Implies -extract")
+	flushEvery := flag.Int("flushEvery", 0,
+		"While fetching a thread, save the comments fetched so far to <cache file>.partial every N comments. "+
+			"After a crash the partial file can be read with -inFile")
+	withParent := flag.Bool("withParent", false,
+		"Add the comment each reply responds to as an ancestors field. Top-level comments have none")
+	parentDepth := flag.Int("parentDepth", 1, "How many levels of parents -withParent walks up the thread")
+	truncate := flag.Int("truncate", 0,
+		"Cut each comment's text in the output to this many characters. Filtering and the cache use the full text")
+	enrichFileName := flag.String("enrich", "",
+		"Re-run extraction over the comments in this JSON or CSV file, e.g. an export made before -extract "+
+			"existed. Shorthand for -inFile=<file> -extract")
+	manifestFile := flag.String("manifest", "",
+		"Write a JSON record of the run to this file: flags, thread, version, counts and where the comments came from")
+	noCache := flag.Bool("noCache", false, "Refetch the thread even if it's cached and replace the cache")
+	checkStale := flag.Bool("checkStale", false,
+		"When reading a thread from the cache, fetch the thread item to warn if it has more comments now")
+	invert := flag.Bool("invert", false,
+		"Keep exactly the comments the -keywords and -match filter would drop, e.g. posts that don't mention remote. "+
+			"-filter-cmd is applied afterwards as usual")
+	root := flag.String("root", "array",
+		"The top-level shape of JSON output: array, or object with the comments under -rootKey")
+	rootKey := flag.String("rootKey", "comments", "The key holding the comments with -root=object")
+	employmentType := flag.String("employmentType", "",
+		"Keep postings offering any of these comma-separated employment types: fulltime, parttime, contract, intern")
+	author := flag.String("author", "",
+		"Keep only comments by these comma-separated users. HN usernames are case-sensitive, so they "+
+			"have to match exactly unless -authorCaseInsensitive is set")
+	authorCaseInsensitive := flag.Bool("authorCaseInsensitive", false, "Match -author ignoring case")
+	withAuthorInfo := flag.Bool("withAuthorInfo", false,
+		"Add the karma of each comment's author. Costs one API request per distinct author of the "+
+			"filtered comments")
+	sortBy := flag.String("sort", "",
+		"Sort the comments: karma for the author's karma, highest first, with comments whose author "+
+			"couldn't be looked up last. Requires -withAuthorInfo")
+	idFilterFile := flag.String("idFilterFile", "",
+		"Keep only the comments whose IDs are listed in this file, one per line with # starting a comment. "+
+			"Combine with -inFile to pick comments out of a cache")
+	seniority := flag.String("seniority", "",
+		"Keep postings for any of these comma-separated seniority levels: junior, mid, senior, staff, principal, "+
+			"lead. Postings that don't mention a level are kept")
+	hasLink := flag.Bool("has-link", false, "Keep only comments with a link, e.g. to apply. Implies -extract")
+	hasEmail := flag.Bool("has-email", false, "Keep only comments with an email address. Implies -extract")
+	explodeDir := flag.String("explode", "",
+		"Write each comment to its own file in this directory, named <ID>.json or after the -format")
+	linkStyle := flag.String("linkStyle", linkText,
+		"How links are rendered in blob and markdown output: text for just the link text, text-url for "+
+			"text (url), url or markdown for [text](url)")
+	showUnmatched := flag.Bool("showUnmatched", false,
+		"Output the comments that failed the filters in a second section after the matching ones, "+
+			"an object with matched and unmatched arrays in JSON. Supports -format json, blob and markdown")
+	perCommentDir := flag.String("per-comment-dir", "",
+		"Write each comment as JSON to <ID>.json in this directory, skipping comments whose file already "+
+			"exists unless -refresh is set")
+	refreshFiles := flag.Bool("refresh", false, "Rewrite -per-comment-dir files that already exist")
+	tagsFile := flag.String("tagsFile", "",
+		"The tags -extract looks for, one per line as 'tag' or 'tag: alias, alias'. Defaults to common technologies")
+	replyCounts := flag.Bool("replyCounts", false,
+		"Add the number of replies to each comment, counting only replies that were fetched or read as well")
+	includeRootText := flag.Bool("includeRootText", false,
+		"Output the -threadID story itself, e.g. the Who's Hiring post, before its comments")
+	filterRoot := flag.Bool("filterRoot", false,
+		"Apply the filters to the -includeRootText story too. By default it's always included as context")
+	backend := flag.String("backend", backendFirebase,
+		"The API threads are fetched from: firebase fetches every comment separately, "+
+			"algolia fetches a thread in one request and falls back to firebase if that fails")
+	histogram := flag.String("histogram", "",
+		"Print a bar chart of the number of filtered comments per day or per hour of the day (UTC) to stderr")
+	groupBy := flag.String("group-by", "",
+		"Output the comments grouped by tag, most common first, in json, ndjson or markdown. "+
+			"A comment is listed under each of its tags. Implies -extract")
+	limit := flag.Int("limit", 0, "Output at most N comments, or at most N per group with -group-by")
+	runHealthcheck := flag.Bool("healthcheck", false,
+		"Fetch a known item from the -backend API, print OK with the round trip time and exit. "+
+			"Exits nonzero if it can't be fetched")
+	threadRetries := flag.Int("thread-retries", 3,
+		"Retry fetching the thread item this many times with exponential backoff before giving up")
+	uniqueAuthorsOnly := flag.Bool("uniqueAuthors", false,
+		"Keep one comment per author, the one matching the most keywords with -annotateMatches, otherwise "+
+			"the first, which is the highest ranked with -rankBy")
+	explain := flag.Bool("explain", false,
+		"Log why each comment was left out with a reason code like filtered_keyword or deleted, and add "+
+			"them to -errorReport. -retry-failures only retries the fetch_error ones")
+	broadMatchWarn := flag.Float64("broadMatchWarn", 95,
+		"Warn if -keywords match at least this percentage of comments, which usually means a keyword "+
+			"is too broad. 0 turns the warning off")
+	http1 := flag.Bool("http1", false, "Fetch over HTTP/1.1 instead of HTTP/2, for networks where HTTP/2 misbehaves")
+	flag.BoolVar(&verbose, "verbose", false, "Log more detail, e.g. the HTTP protocol used for each host")
+	lastN := flag.Int("last-n", 0,
+		"Fetch the comments of the last N monthly Who is hiring threads instead of -threadID, e.g. for trends. "+
+			"Top-level comments of each thread have the thread as their parent")
+	flag.StringVar(&apiBase, "apiBase", apiBase, "The base URL of the HN API, e.g. to use a mirror or a local copy")
+	mirrors := flag.String("apiMirrors", "",
+		"Comma-separated base URLs of HN API mirrors, tried in order when a request to -apiBase fails")
+	authorsOnly := flag.Bool("authors-only", false,
+		"Output the distinct authors of the filtered comments with their number of comments instead of the comments")
+	authorsSort := flag.String("authors-sort", authorsByName,
+		"How -authors-only sorts authors: name, or count for the most comments first")
+	deadline := flag.Duration("deadline", 0,
+		"Stop fetching after this long, e.g. 30s, and output the comments fetched so far. Covers the whole run, "+
+			"including -filter-cmd, -withAuthorInfo, translation and uploads. Exits with status 3 if the output is "+
+			"incomplete. Incomplete threads aren't cached")
+	depth := flag.Int("depth", 1,
+		"How many levels of replies to fetch: 1 for only top-level comments, 2 to add their replies and so on. "+
+			"0 fetches the whole tree")
+	maxChildren := flag.Int("max-children", 0,
+		"Follow at most this many replies of each comment with -depth, to sample a large tree. 0 follows all. "+
+			"Every comment of a level is requested at once, so this also bounds the requests in flight")
+	printConfig := flag.Bool("print-config", false,
+		"Print the value of every flag and whether it came from the command line, the environment or "+
+			"the default as JSON to stderr before running")
+	retryFrom := flag.String("retryFrom", "",
+		"Fetch only the comments that failed in the run that wrote this -errorReport file, like -commentIDs. "+
+			"Add -append to merge them into that run's -outFile")
+	rankBy := flag.String("rankBy", "",
+		"Sort comments by a score, highest first, and add it to the output. The score sums the comma-separated "+
+			"features with optional weights, e.g. density:2,length,salary. Features: density of -keywords, "+
+			"length, links, emails, salary and remote")
+	dateFormat := flag.String("date-format", "rfc3339",
+		"How the createdAt field renders the time a comment was posted, in UTC: rfc3339, date, datetime, "+
+			"unix, or a Go time layout such as 02/01/2006")
+	resume := flag.Bool("resume", false,
+		"Resume an interrupted -threadsFile or -last-n batch: threads the earlier run finished are read "+
+			"from their caches instead of being fetched again. Progress is tracked in the cache directory "+
+			"and cleared when a batch completes")
+	mergeCache := flag.Bool("mergeCache", false,
+		"Read the thread's cache, fetch only the comments that aren't in it, e.g. posted since, and add "+
+			"them to the cache. Outputs all of them. New replies to cached comments aren't found")
+	cacheFormat := flag.String("cacheFormat", cacheFormatArray,
+		"How thread caches are written: array for a JSON array, or jsonl for a comment per line, which "+
+			"-decodeWorkers can decode while reading. Caches in either format are read")
+	strictCache := flag.Bool("strict-cache", false,
+		"Fail if a thread's cache file is corrupt instead of refetching the thread and replacing it")
+	rampPeriod := flag.Duration("ramp", 0,
+		"Start fetching a thread's comments one at a time and reach full concurrency over this period, "+
+			"e.g. 5s, to avoid a burst of requests at the start. Combines with -rps")
+	cpuProfile := flag.String("cpuprofile", "", "Write a pprof CPU profile of the run to this file")
+	memProfile := flag.String("memprofile", "", "Write a pprof heap profile to this file at the end of the run")
+	noParent := flag.Bool("no-parent", false,
+		"Leave the parent field out of JSON and ndjson output. -tree nests replies by their parent instead")
+	withStoryHeader := flag.Bool("story-header", false,
+		"Start the output with the -threadID story's title, url, score and number of comments. JSON output "+
+			"becomes an object with the story and the comments under -rootKey, ndjson starts with a story line")
+	validateFile := flag.String("validate", "",
+		"Check the comments in this cache or output file and exit: every comment needs an ID, an author "+
+			"and text unless it's deleted, and IDs must be unique. Exits nonzero if there are problems")
+	outputFlushEvery := flag.Int("outputFlushEvery", 1,
+		"Flush -format ndjson output after every N comments so consumers reading it as it's written, "+
+			"e.g. through a pipe, get them promptly. 0 flushes only at the end. With -append every line "+
+			"is written on its own so a run that's killed leaves at most a partial last line, which the "+
+			"next -append removes")
+	checkQuery := flag.Bool("check-query", false,
+		"Parse -keywords and the other filter flags, print the keywords they match and exit without "+
+			"fetching anything. Exits nonzero if a flag is invalid or the keywords can never match")
+	emailDomains := flag.String("emailDomains", "",
+		"Keep only extracted emails at these comma-separated domains or their subdomains, case-insensitively, "+
+			"e.g. acme.com,io. Applies to -extract and -extractContacts and implies -extract without the latter")
+	excludeEmailDomains := flag.String("excludeEmailDomains", "",
+		"Drop extracted emails at these comma-separated domains or their subdomains, e.g. gmail.com,yahoo.com. "+
+			"Applies like -emailDomains")
+	withContacts := flag.Bool("extractContacts", false,
+		"Add a contacts field with the email addresses, including obfuscated ones like "+
+			"\"name [at] acme [dot] com\", and the application links of each posting")
+	parseHeaders := flag.Bool("parseHeader", false,
+		"Add a header field with the pipe-separated fields of the first line of each posting, e.g. "+
+			"\"Acme | Engineer | Berlin | REMOTE | $120k\", as tags and, where they can be told apart, the role, "+
+			"location, remote status and compensation")
+	best := flag.Int("best", 0,
+		"Output the N most relevant comments, a shorthand for -rankBy density -limit N. Comments are ranked "+
+			"by how many -keywords they contain per word. -rankBy and -limit override it")
+	rps := flag.Float64("rps", 0, "Fetch at most this many comments per second, 0 doesn't limit it")
+	threadsFile := flag.String("threadsFile", "",
+		"Fetch the threads listed in this file instead of -threadID, one ID per line with an optional rps "+
+			"after a comma to fetch that thread's comments at instead of -rps, e.g. 12345,2")
+	dedupeBy := flag.String("dedupeBy", dedupeByID,
+		"Keep only the first comment of each id, text or author. text compares the comments without HTML, "+
+			"case and whitespace differences, to drop reposts")
+	kafkaTopic := flag.String("kafka", "",
+		"Produce every output comment as an NDJSON message to this Kafka topic on -kafkaBrokers. "+
+			"Requires building with -tags kafka")
+	kafkaBrokers := flag.String("kafkaBrokers", "localhost:9092", "Comma-separated Kafka brokers for -kafka")
+	kafkaUser := flag.String("kafkaUser", "", "The SASL/PLAIN username for -kafkaBrokers, if they require one")
+	kafkaPassword := flag.String("kafkaPassword", "", "The SASL/PLAIN password for -kafkaUser")
+	gzipOutput := flag.Bool("gzip", false, "Compress the output written to -outFile or stdout with gzip")
+	appendOutput := flag.Bool("append", false,
+		"Add to -outFile instead of replacing it. With -format ndjson the comments are appended as lines. "+
+			"With -format json they're merged into the file's array, replacing comments with the same ID, "+
+			"which rewrites the whole file. Other formats can't be appended to")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output(), "\nEvery flag can also be set with an environment variable, "+
+			"HN_ and the flag in upper snake case, e.g. HN_THREAD_ID for -threadID. Flags take precedence")
+	}
+	flag.Parse()
+	fromCommandLine := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		fromCommandLine[f.Name] = true
+	})
+	fatalnWrapper(flagsFromEnv(flag.CommandLine, os.LookupEnv))
+	if *printConfig {
+		encoder := json.NewEncoder(os.Stderr)
+		encoder.SetIndent("", "  ")
+		fatalnWrapper(encoder.Encode(resolvedConfig(flag.CommandLine, fromCommandLine)))
+	}
+
+	//Fetching stops at the deadline and the comments fetched so far are output. Deferred first so
+	//it runs last, after the manifest and error report are written
+	ctx := context.Background()
+	truncated := false
+	if *deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *deadline)
+		defer cancel()
+		defer func() {
+			if truncated {
+				os.Exit(exitTruncated)
+			}
+		}()
+	}
+
+	stopProfiles, err := startProfiles(*cpuProfile, *memProfile)
+	fatalnWrapper(err)
+	defer stopProfiles()
+
+	var jsonRootKey string
+	switch *root {
+	case "array":
+	case "object":
+		jsonRootKey = *rootKey
+	default:
+		log.Fatalf("Invalid -root %q, expected array or object", *root)
+	}
+	//The story is output next to the comments, which needs an object
+	if *withStoryHeader && *format == formatJSON {
+		if *appendOutput {
+			log.Fatalln("-story-header can't be combined with -append")
+		}
+		jsonRootKey = *rootKey
+	}
+
+	if *retryFrom != "" && *commentIDs != "" {
+		log.Fatalln("-retryFrom and -commentIDs can't be combined")
+	}
+
+	if *noCache && *offline {
+		log.Fatalln("-noCache and -offline can't be combined")
+	}
+
+	manifest := newRunManifest(time.Now())
+	if *manifestFile != "" {
+		defer func() {
+			manifest.Mirrors = mirrorUses.snapshot()
+			if err := manifest.write(*manifestFile); err != nil {
+				log.Println("Writing manifest:", err)
+			}
+		}()
+	}
+
+	if *enrichFileName != "" {
+		*inFileName = *enrichFileName
+		*extractFields = true
+	}
+
+	if *best > 0 {
+		if *rankBy == "" {
+			*rankBy = featureDensity
+		}
+		if *limit == 0 {
+			*limit = *best
+		}
+	}
+
+	var rankWeights []rankWeight
+	if *rankBy != "" {
+		var err error
+		rankWeights, err = parseRankBy(*rankBy)
+		fatalnWrapper(err)
+	}
+
+	if *withLinkIndex || *hasLink || *hasEmail || rankNeedsExtract(rankWeights) {
+		*extractFields = true
+	}
+	domains := emailDomainFilter{
+		allow: parseEmailDomains(*emailDomains),
+		deny:  parseEmailDomains(*excludeEmailDomains),
+	}
+	if (*emailDomains != "" || *excludeEmailDomains != "") && !*withContacts {
+		*extractFields = true
+	}
+
+	if *authorsOnly {
+		if *authorsSort != authorsByName && *authorsSort != authorsByCount {
+			log.Fatalf("Invalid -authors-sort %q, expected name or count", *authorsSort)
+		}
+		if *asTree || *groupBy != "" || *appendOutput {
+			log.Fatalln("-authors-only can't be combined with -tree, -group-by or -append")
+		}
+	}
+
+	if *groupBy != "" {
+		fatalnWrapper(validateGroupBy(*groupBy))
+		if *format == formatBlob || *format == formatRSS || *format == formatAtom || *format == formatSummaryCSV ||
+			*format == formatDOT || *asTree {
+			log.Fatalln("-group-by can't be combined with -format blob, rss, atom, summary-csv or dot or -tree")
+		}
+		*extractFields = true
+	}
+	if *format == formatSummaryCSV {
+		*extractFields = true
+	}
+	fatalnWrapper(validateLinkStyle(*linkStyle))
+	if *showUnmatched {
+		fatalnWrapper(validateShowUnmatched(*format))
+		if *asTree || *groupBy != "" || *authorsOnly || *appendOutput || *decodeWorkers > 0 || *withStoryHeader {
+			log.Fatalln("-showUnmatched can't be combined with -tree, -group-by, -authors-only, -append, " +
+				"-decodeWorkers or -story-header")
+		}
+	}
+
+	if *translateTo != "" && *translateURL == "" {
+		log.Fatalln("-translateTo requires -translateURL")
+	}
+
+	writerOpts := writerOptions{
+		filename: *outFileName,
+		format:   *format,
+		gzip:     *gzipOutput,
+		append:   *appendOutput,
+		rootKey:  jsonRootKey,
+		nested:   *asTree || *groupBy != "" || *showUnmatched,
+	}
+	fatalnWrapper(writerOpts.validate())
+	if *appendOutput && *rawPassthrough {
+		log.Fatalln("-append can't be combined with -rawPassthrough")
+	}
+	fatalnWrapper(validateBackend(*backend))
+	apiBase = strings.TrimSuffix(apiBase, "/")
+	for _, mirror := range strings.Split(*mirrors, ",") {
+		if mirror = strings.TrimSuffix(strings.TrimSpace(mirror), "/"); mirror != "" {
+			apiMirrors = append(apiMirrors, mirror)
+		}
+	}
+	if *http1 {
+		httpClient = newHTTPClient(true)
+	}
+	if *validateFile != "" {
+		problems, err := validateCommentsFile(os.Stdout, *validateFile)
+		fatalnWrapper(err)
+		if problems > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	if *runHealthcheck {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		fatalnWrapper(healthcheck(ctx, os.Stdout, *backend))
+		return
+	}
+	if *histogram != "" {
+		fatalnWrapper(validateHistogramPeriod(*histogram))
+	}
+	fatalnWrapper(validateDedupeBy(*dedupeBy))
+	fatalnWrapper(validateSort(*sortBy))
+	fatalnWrapper(validateCacheFormat(*cacheFormat))
+	if *sortBy == sortByKarma && !*withAuthorInfo {
+		log.Fatalln("-sort karma requires -withAuthorInfo")
+	}
+
+	if *outS3 != "" && uploadToS3 == nil {
+		log.Fatalln("-outS3 is unavailable, rebuild with -tags s3 to enable it")
+	}
+
+	if *kafkaTopic != "" && produceToKafka == nil {
+		log.Fatalln("-kafka is unavailable, rebuild with -tags kafka to enable it")
+	}
+
+	if *metricsAddr != "" {
+		if serveMetrics == nil {
+			log.Fatalln("-metricsAddr is unavailable, rebuild with -tags prometheus to enable it")
+		}
+		serveMetrics(*metricsAddr)
+	}
+
+	opts := []fetchOption{withRateLimit(*rps), withRamp(*rampPeriod)}
+	if *showProgress {
+		opts = append(opts, withProgress(os.Stderr))
+	}
+
+	if *cacheComments && !*rawPassthrough {
+		opts = append(opts, withCommentCache(filepath.Join(cacheDir(), "comments"), *commentCacheTTL))
+	}
+
+	opts = append(opts, withThreadRetries(*threadRetries), withDepth(*depth, *maxChildren))
+
+	//Passing the API responses through needs one response per comment
+	if !*rawPassthrough {
+		opts = append(opts, withBackend(*backend))
+	}
+
+	if *rawPassthrough {
+		raws := make([]json.RawMessage, 0)
+		opts = append(opts, withOnRaw(func(raw json.RawMessage) {
+			raws = append(raws, raw)
+		}))
+		if *commentIDs != "" {
+			ids, err := parseCommentIDs(*commentIDs)
+			fatalnWrapper(err)
+			fetchComments(ctx, ids, opts...)
+		} else {
+			if _, err := fetchFromAPI(ctx, int64(*threadID), opts...); err != nil && ctx.Err() == nil {
+				log.Fatalln(err)
+			}
+		}
+		truncated = ctx.Err() != nil
+
+		//The responses are always a JSON array
+		writerOpts.format = formatJSON
+		writerOpts.rootKey = ""
+		out, err := newOutputWriter(writerOpts)
+		fatalnWrapper(err)
+		fatalnWrapper(json.NewEncoder(out).Encode(raws))
+		fatalnWrapper(out.Close())
+		return
+	}
+
+	var failures []fetchFailure
+	opts = append(opts, withOnError(func(id int64, err error) {
+		failures = append(failures, fetchFailure{ID: id, Reason: reasonFetchError, Error: err.Error()})
+	}))
+
+	var skips *skipLog
+	if *explain {
+		skips = &skipLog{}
+	}
+
+	//If we have no keywords, pipe all to the outfile. Otherwise filter by keywords
+	keywords := parseKeywords(*keywordsStr)
+	keywordMatches := &matchCounter{}
+	var filter filterFunction
+	minMatches := 0
+	if len(keywords) == 0 {
+		filter = func(c *hnComment) bool {
+			return true
+		}
+	} else {
+		var err error
+		minMatches, err = parseMatchMode(*matchMode, keywords)
+		fatalnWrapper(err)
+		if *matchMin > 0 {
+			minMatches = *matchMin
+		}
+		options := keywordOptions{annotate: *annotateMatches, minMatches: minMatches}
+		filter = filterTextFromKeywords(keywords, options)
+		if *keywordsAnyField {
+			filter = filterFieldsFromKeywords(keywords, options, allTextFields)
+		}
+		filter = keywordMatches.count(filter)
+	}
+
+	if *invert {
+		keep := filter
+		filter = func(c *hnComment) bool {
+			return !keep(c)
+		}
+	}
+	filter = skips.explain(reasonFilteredKeyword, filter)
+
+	if *employmentType != "" {
+		var types []string
+		for _, value := range strings.Split(*employmentType, ",") {
+			t, err := normalizeEmploymentType(strings.TrimSpace(value))
+			fatalnWrapper(err)
+			types = append(types, t)
+		}
+		filter = allOf(filter, skips.explain(reasonFilteredEmploymentType, filterEmploymentTypes(types)))
+	}
+
+	if *minWords > 0 {
+		filter = allOf(filter, skips.explain(reasonTooShort, filterMinWords(*minWords)))
+	}
+
+	if *idFilterFile != "" {
+		ids, err := readIDFile(*idFilterFile)
+		fatalnWrapper(err)
+		filter = allOf(filter, skips.explain(reasonFilteredID, filterIDs(ids)))
+	}
+
+	if *author != "" {
+		var authors []string
+		for _, a := range strings.Split(*author, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				authors = append(authors, a)
+			}
+		}
+		filter = allOf(filter, skips.explain(reasonFilteredAuthor, filterAuthors(authors, *authorCaseInsensitive)))
+	}
+
+	if *seniority != "" {
+		var levels []string
+		for _, value := range strings.Split(*seniority, ",") {
+			l, err := normalizeSeniority(strings.TrimSpace(value))
+			fatalnWrapper(err)
+			levels = append(levels, l)
+		}
+		filter = allOf(filter, skips.explain(reasonFilteredSeniority, filterSeniority(levels)))
+	}
+
+	if *hasLink {
+		filter = allOf(filter, skips.explain(reasonFilteredLink, filterHasLink))
+	}
+	if *hasEmail {
+		filter = allOf(filter, skips.explain(reasonFilteredEmail, filterHasEmail))
+	}
+
+	//Extract before filtering so filters can use the extracted fields
+	if *extractFields {
+		options := extractOptions{
+			normalize:    *normalizeExtracted,
+			tags:         loadTagDictionary(*tagsFile),
+			emailDomains: domains,
+		}
+		keywordFilter := filter
+		filter = func(c *hnComment) bool {
+			extract(c, options)
+			return keywordFilter(c)
+		}
+	}
+
+	if *checkQuery {
+		check := queryCheck{Keywords: keywords, MinMatches: minMatches, Invert: *invert, AnyField: *keywordsAnyField}
+		fatalnWrapper(check.write(os.Stdout))
+		return
+	}
+
+	if *withContacts {
+		contactsFilter := filter
+		filter = func(c *hnComment) bool {
+			c.Contacts = extractContacts(c.Text, domains)
+			return contactsFilter(c)
+		}
+	}
+
+	if *parseHeaders {
+		headerFilter := filter
+		filter = func(c *hnComment) bool {
+			c.Header = parseHeader(c.Text)
+			return headerFilter(c)
+		}
+	}
+
+	var comments []hnComment
+	var filteredComments []hnComment
+	if *inFileName != "" && *decodeWorkers > 0 && !strings.EqualFold(filepath.Ext(*inFileName), ".csv") {
+		inFile, err := os.Open(*inFileName)
+		fatalnWrapper(err)
+		filteredComments, err = filterFromFileStreaming(inFile, filter, *decodeWorkers)
+		inFile.Close()
+		fatalnWrapper(err)
+		//The unfiltered comments aren't kept in memory so only replies that passed are counted
+		if *replyCounts {
+			countReplies(filteredComments)
+		}
+		manifest.Source = commentSource{Kind: "file", Path: *inFileName}
+	} else if *inFileName != "" {
+		var err error
+		comments, err = readCommentsFile(*inFileName)
+		fatalnWrapper(err)
+		manifest.Source = commentSource{Kind: "file", Path: *inFileName}
+	} else if *retryFailuresFile != "" {
+		if *threadID == 0 {
+			log.Fatalln("-retry-failures requires the -threadID whose cache the comments are merged into")
+		}
+		var err error
+		policy := cachePolicy{format: *cacheFormat, variant: cacheVariant(*depth, *maxChildren)}
+		comments, err = retryFailures(ctx, *retryFailuresFile, *threadID, policy, opts...)
+		fatalnWrapper(err)
+		manifest.ThreadIDs = []int{*threadID}
+		manifest.Source = commentSource{Kind: "cache", Path: policy.cacheFile(*threadID)}
+	} else if *commentIDs != "" {
+		ids, err := parseCommentIDs(*commentIDs)
+		fatalnWrapper(err)
+		comments = fetchComments(ctx, ids, opts...)
+		manifest.Source = commentSource{Kind: "commentIDs"}
+	} else if *retryFrom != "" {
+		ids, err := readFailures(*retryFrom)
+		fatalnWrapper(err)
+		log.Printf("Retrying %d comments from %s", len(ids), *retryFrom)
+		comments = fetchComments(ctx, ids, opts...)
+		manifest.Source = commentSource{Kind: "retry", Path: *retryFrom}
+	} else {
+		manifest.ThreadIDs = []int{*threadID}
+		//The -threadsFile threads with their own rate limit
+		threadRPS := make(map[int]float64)
+		if *threadsFile != "" {
+			threads, err := readThreadsFile(*threadsFile)
+			fatalnWrapper(err)
+			manifest.ThreadIDs = nil
+			for _, t := range threads {
+				manifest.ThreadIDs = append(manifest.ThreadIDs, t.ID)
+				if t.rps > 0 {
+					threadRPS[t.ID] = t.rps
+				}
+			}
+		} else if *lastN > 0 {
+			if *offline {
+				log.Fatalln("-last-n needs to look up the threads and can't be used offline")
+			}
+			ids, err := lastHiringThreads(ctx, *lastN)
+			fatalnWrapper(err)
+			manifest.ThreadIDs = nil
+			for _, id := range ids {
+				manifest.ThreadIDs = append(manifest.ThreadIDs, int(id))
+			}
+		}
+		policy := cachePolicy{
+			ttl:        *cacheTTL,
+			offline:    *offline,
+			refresh:    *noCache,
+			checkStale: *checkStale,
+			flushEvery: *flushEvery,
+			strict:     *strictCache,
+			format:     *cacheFormat,
+			merge:      *mergeCache,
+			variant:    cacheVariant(*depth, *maxChildren),
+		}
+		//Batches of threads record which threads are done so -resume can read them from their caches
+		batch := len(manifest.ThreadIDs) > 1
+		stateFile := batchStateFile(manifest.ThreadIDs)
+		state := batchState{Threads: manifest.ThreadIDs}
+		done := make(map[int]bool)
+		if batch && *resume {
+			var err error
+			done, err = readBatchDone(stateFile)
+			fatalnWrapper(err)
+			log.Printf("Resuming the batch, %d of %d threads are done", len(done), len(manifest.ThreadIDs))
+		}
+		for i, id := range manifest.ThreadIDs {
+			//Past the deadline, output what the threads before got
+			if ctx.Err() != nil {
+				log.Printf("Stopped fetching (%v), skipping the last %d threads", ctx.Err(), len(manifest.ThreadIDs)-i)
+				break
+			}
+			threadOpts := opts
+			if rps, ok := threadRPS[id]; ok {
+				threadOpts = append(append([]fetchOption{}, opts...), withRateLimit(rps))
+			}
+			threadPolicy := policy
+			if done[id] {
+				//Already fetched in the interrupted run, keep what it cached
+				threadPolicy.ttl, threadPolicy.refresh, threadPolicy.merge = 0, false, false
+			}
+			threadComments, source := getComments(ctx, id, threadPolicy, threadOpts...)
+			comments = append(comments, threadComments...)
+			manifest.Source = source
+			if batch && ctx.Err() == nil {
+				state.Done = append(state.Done, id)
+				if err := writeJSONAtomic(stateFile, state); err != nil {
+					log.Println("Not saving the batch progress:", err)
+				}
+			}
+		}
+		if batch && ctx.Err() == nil {
+			os.Remove(stateFile)
+		}
+		if *lastN > 0 && len(manifest.ThreadIDs) > 1 {
+			manifest.Source = commentSource{Kind: "whoishiring"}
+		} else if *threadsFile != "" && len(manifest.ThreadIDs) > 1 {
+			manifest.Source = commentSource{Kind: "threadsFile", Path: *threadsFile}
+		}
+	}
+
+	truncated = ctx.Err() != nil
+	//Reports whether the deadline passed, logging what was cut short because of it. The steps after
+	//fetching make requests of their own and are cut short too
+	pastDeadline := func(what string) bool {
+		if ctx.Err() == nil {
+			return false
+		}
+		log.Printf("The deadline passed, %s", what)
+		truncated = true
+		return true
+	}
+
+	//Written once everything that can skip comments has run
+	if *errorReport != "" || skips != nil {
+		defer func() {
+			skipped := append(failures, skips.list()...)
+			if skips != nil {
+				log.Printf("Skipped %d comments (%s)", len(skipped), summarizeSkips(skipped))
+			}
+			if *errorReport != "" {
+				fatalnWrapper(writeErrorReport(*errorReport, skipped))
+			}
+		}()
+	}
+	manifest.Counts.Loaded = len(comments)
+	manifest.Counts.Failed = len(failures)
+
+	var rootComment hnComment
+	var story *storyHeader
+	if *includeRootText || *withStoryHeader {
+		if *threadID == 0 || *offline {
+			log.Fatalln("-includeRootText and -story-header need to fetch the -threadID story and can't be used offline")
+		}
+		thread, err := getThreadFromAPI(ctx, itemURL(int64(*threadID)))
+		if err != nil && !pastDeadline("leaving out the story") {
+			fatalnWrapper(err)
+		}
+		if *withStoryHeader && thread != nil {
+			story = thread.storyHeader()
+		}
+		if *includeRootText && thread != nil {
+			rootComment = thread.rootComment()
+			if *filterRoot {
+				comments = append([]hnComment{rootComment}, comments...)
+			}
+		}
+	}
+
+	if *replyCounts {
+		countReplies(comments)
+	}
+	var unmatchedComments []hnComment
+	for i := range comments {
+		if filter(&comments[i]) {
+			filteredComments = append(filteredComments, comments[i])
+		} else if *showUnmatched {
+			unmatchedComments = append(unmatchedComments, comments[i])
+		}
+	}
+
+	warnIfTooBroad(keywordMatches, *broadMatchWarn)
+
+	if *filterCmd != "" {
+		kept, err := filterWithCommand(ctx, filteredComments, *filterCmd, *filterCmdJobs)
+		if err != nil && !pastDeadline("dropping the comments -filterCmd didn't get to") {
+			fatalnWrapper(err)
+		}
+		skips.addDropped(filteredComments, kept, reasonFilteredCommand)
+		filteredComments = kept
+	}
+
+	//Rank before the steps that pick comments so they keep the best ones
+	if rankWeights != nil {
+		rankComments(filteredComments, keywords, rankWeights)
+	}
+
+	if *withAuthorInfo {
+		if *offline {
+			log.Fatalln("-withAuthorInfo needs to look up the authors and can't be used offline")
+		}
+		addAuthorInfo(ctx, filteredComments)
+		pastDeadline("some authors weren't looked up")
+	}
+	if *sortBy == sortByKarma {
+		sortByAuthorKarma(filteredComments)
+	}
+
+	deduped := dedupeComments(filteredComments, *dedupeBy)
+	skips.addDropped(filteredComments, deduped, reasonDuplicate)
+	filteredComments = deduped
+
+	if *uniqueAuthorsOnly {
+		kept := uniqueAuthors(filteredComments)
+		skips.addDropped(filteredComments, kept, reasonDuplicateAuthor)
+		filteredComments = kept
+	}
+
+	if *samplePct > 0 {
+		if *seed == 0 {
+			*seed = time.Now().UnixNano()
+		}
+		sampled := samplePercent(filteredComments, *samplePct, rand.New(rand.NewSource(*seed)))
+		skips.addDropped(filteredComments, sampled, reasonSampledOut)
+		filteredComments = sampled
+	}
+
+	//The histogram goes to stderr so the output is the same with or without it
+	if *histogram != "" {
+		if err := writeHistogram(os.Stderr, filteredComments, *histogram); err != nil {
+			log.Println("Writing histogram:", err)
+		}
+	}
+
+	//With -group-by the limit applies to each group when writing
+	if *limit > 0 && *groupBy == "" && len(filteredComments) > *limit {
+		skips.addDropped(filteredComments, filteredComments[:*limit], reasonOverLimit)
+		filteredComments = filteredComments[:*limit]
+	}
+
+	//Without -filterRoot the root is context and bypasses every filter
+	if *includeRootText && !*filterRoot {
+		filteredComments = append([]hnComment{rootComment}, filteredComments...)
+	}
+
+	if *withParent {
+		if *offline {
+			log.Fatalln("-withParent needs to fetch the parents and can't be used offline")
+		}
+		var cache *commentCache
+		if *cacheComments {
+			cache = &commentCache{dir: filepath.Join(cacheDir(), "comments"), ttl: *commentCacheTTL}
+		}
+		attachAncestors(ctx, filteredComments, *parentDepth, cache)
+	}
+
+	if *translateTo != "" {
+		t := &translator{
+			url:      *translateURL,
+			key:      *translateKey,
+			target:   *translateTo,
+			cacheDir: filepath.Join(cacheDir(), "translations"),
+		}
+		t.translateAll(ctx, filteredComments)
+		pastDeadline("some comments weren't translated")
+	}
+
+	if *snippetSize > 0 && len(keywords) > 0 {
+		for i := range filteredComments {
+			filteredComments[i].Text = snippet(filteredComments[i].Text, keywords, *snippetSize)
+		}
+	}
+
+	if *compact {
+		kept := compactComments(filteredComments)
+		skips.addDropped(filteredComments, kept, reasonTooShort)
+		filteredComments = kept
+	}
+
+	//Truncate last so everything before it works on the full text
+	if *truncate > 0 {
+		for i := range filteredComments {
+			filteredComments[i].Text = truncateText(filteredComments[i].Text, *truncate)
+		}
+		for i := range unmatchedComments {
+			unmatchedComments[i].Text = truncateText(unmatchedComments[i].Text, *truncate)
+		}
+	}
+
+	setCreatedAt(filteredComments, *dateFormat)
+	setCreatedAt(unmatchedComments, *dateFormat)
+
+	manifest.Counts.Output = len(filteredComments)
+	if len(filteredComments) == 0 && len(unmatchedComments) == 0 {
+		log.Println("No results found based on the keywords supplied. Not writing outFile")
+		return
+	}
+
+	if *outS3 != "" {
+		var body bytes.Buffer
+		options := outputOptions{
+			format:        *format,
+			tree:          *asTree,
+			linkIndex:     *withLinkIndex,
+			rootKey:       jsonRootKey,
+			groupBy:       *groupBy,
+			groupLimit:    *limit,
+			authorsOnly:   *authorsOnly,
+			authorsSort:   *authorsSort,
+			story:         story,
+			noParent:      *noParent,
+			showUnmatched: *showUnmatched,
+			unmatched:     unmatchedComments,
+			linkStyle:     *linkStyle,
+		}
+		err := writeComments(&body, filteredComments, options)
+		fatalnWrapper(err)
+		name := s3ObjectName(*threadID, time.Now(), formatExtension(*format))
+		err = uploadToS3(ctx, *outS3, name, body.Bytes())
+		if err != nil && !pastDeadline("the upload to S3 didn't finish") {
+			fatalnWrapper(err)
+		}
+	}
+
+	if *kafkaTopic != "" {
+		config := kafkaConfig{
+			brokers:  strings.Split(*kafkaBrokers, ","),
+			topic:    *kafkaTopic,
+			user:     *kafkaUser,
+			password: *kafkaPassword,
+		}
+		err := produceToKafka(ctx, config, filteredComments)
+		if err == nil {
+			log.Printf("Produced %d comments to Kafka topic %s", len(filteredComments), *kafkaTopic)
+		} else if !pastDeadline("producing to Kafka didn't finish") {
+			fatalnWrapper(err)
+		}
+	}
+
+	if *explodeDir != "" {
+		options := outputOptions{format: *format, noParent: *noParent, linkStyle: *linkStyle}
+		_, err := explodeComments(*explodeDir, filteredComments, options, false)
+		fatalnWrapper(err)
+		log.Printf("Wrote %d comments to %s", len(filteredComments), *explodeDir)
+	}
+
+	if *perCommentDir != "" {
+		options := outputOptions{format: formatJSON, noParent: *noParent}
+		written, err := explodeComments(*perCommentDir, filteredComments, options, !*refreshFiles)
+		fatalnWrapper(err)
+		log.Printf("Wrote %d comments to %s, %d already had a file", written, *perCommentDir,
+			len(filteredComments)-written)
+	}
+
+	//Write to our outfile, S3, Kafka, -explode and -per-comment-dir replace the stdout default
+	if *appendOutput && *format == formatJSON {
+		total, err := appendJSON(*outFileName, filteredComments)
+		fatalnWrapper(err)
+		log.Printf("Merged %d comments into %s, which now has %d", len(filteredComments), *outFileName, total)
+	} else if (*outS3 == "" && *kafkaTopic == "" && *explodeDir == "" && *perCommentDir == "") ||
+		*outFileName != "" {
+		//The output file to write the filtered comments to, defaults to stdout
+		out, err := newOutputWriter(writerOpts)
+		fatalnWrapper(err)
+		options := outputOptions{
+			format:        *format,
+			tree:          *asTree,
+			color:         out.color(*noColor),
+			linkIndex:     *withLinkIndex,
+			rootKey:       jsonRootKey,
+			groupBy:       *groupBy,
+			groupLimit:    *limit,
+			authorsOnly:   *authorsOnly,
+			authorsSort:   *authorsSort,
+			flushEvery:    *outputFlushEvery,
+			story:         story,
+			noParent:      *noParent,
+			showUnmatched: *showUnmatched,
+			unmatched:     unmatchedComments,
+			linkStyle:     *linkStyle,
+		}
+		//Appended lines go through a single writer that writes and flushes each one whole
+		var dest io.Writer = out
+		var records *recordWriter
+		if *appendOutput {
+			records = newRecordWriter(out)
+			dest = records
+		}
+		if err := writeComments(dest, filteredComments, options); err != nil {
+			log.Fatalln(err)
+		}
+		if records != nil {
+			fatalnWrapper(records.Close())
+		}
+		fatalnWrapper(out.Close())
 	}
 }
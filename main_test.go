@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJSONKind(t *testing.T) {
+	tests := []struct {
+		body string
+		kind string
+	}{
+		{`{"id": 1}`, "object"},
+		{`[1, 2]`, "array"},
+		{`"oops"`, "string"},
+		{`38490000`, "number"},
+		{`true`, "bool"},
+		{`null`, "null"},
+		{"  \n{}", "object"},
+	}
+	for _, test := range tests {
+		kind, err := jsonKind([]byte(test.body))
+		if err != nil {
+			t.Errorf("jsonKind(%q) failed: %v", test.body, err)
+			continue
+		}
+		if kind != test.kind {
+			t.Errorf("jsonKind(%q) = %q, want %q", test.body, kind, test.kind)
+		}
+	}
+
+	if _, err := jsonKind([]byte("")); err == nil {
+		t.Error("jsonKind of an empty body didn't fail")
+	}
+}
+
+func TestDecodeObject(t *testing.T) {
+	const url = "https://example.com/v0/item/1.json"
+	tests := []struct {
+		name string
+		body string
+		//The kind of the *unexpectedShapeError expected, empty if the body decodes
+		kind string
+	}{
+		{"object", `{"by": "alice", "id": 1, "text": "Acme"}`, ""},
+		{"bare number", `38490000`, "number"},
+		{"bare string", `"oops"`, "string"},
+		{"null", `null`, "null"},
+		{"array", `[{"id": 1}]`, "array"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var c hnComment
+			err := decodeObject(url, []byte(test.body), &c)
+			if test.kind == "" {
+				if err != nil {
+					t.Fatalf("decodeObject failed: %v", err)
+				}
+				if c.ID != 1 || c.By != "alice" {
+					t.Errorf("decoded %+v", c)
+				}
+				return
+			}
+			var shapeErr *unexpectedShapeError
+			if !errors.As(err, &shapeErr) {
+				t.Fatalf("decodeObject returned %v, want an *unexpectedShapeError", err)
+			}
+			if shapeErr.Kind != test.kind || shapeErr.URL != url {
+				t.Errorf("got %+v, want kind %q", shapeErr, test.kind)
+			}
+		})
+	}
+
+	var c hnComment
+	if err := decodeObject(url, []byte(`{"id": `), &c); err == nil {
+		t.Error("decodeObject of invalid JSON didn't fail")
+	}
+}
+
+func TestErrorFromBody(t *testing.T) {
+	tests := []struct {
+		body    string
+		message string
+	}{
+		{`{"error": "Too many requests"}`, "Too many requests"},
+		{`{"error": {"code": 503}}`, `{"code": 503}`},
+		//An item that happens to have an error field is still an item
+		{`{"id": 1, "error": "x"}`, ""},
+		{`{"id": 1, "text": "Acme"}`, ""},
+		{`{}`, ""},
+		{`"oops"`, ""},
+	}
+	for _, test := range tests {
+		err := errorFromBody("u", []byte(test.body))
+		if test.message == "" {
+			if err != nil {
+				t.Errorf("errorFromBody(%s) = %v, want nil", test.body, err)
+			}
+			continue
+		}
+		var bodyErr *errorBodyError
+		if !errors.As(err, &bodyErr) || bodyErr.Message != test.message {
+			t.Errorf("errorFromBody(%s) = %v, want an *errorBodyError with %q", test.body, err, test.message)
+		}
+	}
+}
+
+func TestDecodeObjectErrorBody(t *testing.T) {
+	var c hnComment
+	err := decodeObject("u", []byte(`{"error": "Too many requests"}`), &c)
+	var bodyErr *errorBodyError
+	if !errors.As(err, &bodyErr) {
+		t.Fatalf("decodeObject returned %v, want an *errorBodyError", err)
+	}
+}
+
+//Serves an error body with a 200 status for the first failures requests, then an item
+func errorBodyServer(failures int32) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			fmt.Fprint(w, `{"error": "Too many requests"}`)
+			return
+		}
+		fmt.Fprint(w, `{"by": "alice", "id": 1, "text": "Acme"}`)
+	}))
+	return server, &requests
+}
+
+//Makes fetchObject retry error bodies right away for the duration of the test
+func noErrorBodyBackoff(t *testing.T) {
+	backoff := errorBodyBackoff
+	errorBodyBackoff = time.Millisecond
+	t.Cleanup(func() { errorBodyBackoff = backoff })
+}
+
+func TestFetchObjectRetriesErrorBodies(t *testing.T) {
+	noErrorBodyBackoff(t)
+	server, requests := errorBodyServer(1)
+	defer server.Close()
+
+	var c hnComment
+	if _, err := fetchObject(context.Background(), server.URL, &c); err != nil {
+		t.Fatalf("fetchObject failed: %v", err)
+	}
+	if c.ID != 1 {
+		t.Errorf("decoded %+v", c)
+	}
+	if *requests != 2 {
+		t.Errorf("sent %d requests, want 2", *requests)
+	}
+}
+
+func TestFetchObjectGivesUpOnErrorBodies(t *testing.T) {
+	noErrorBodyBackoff(t)
+	server, requests := errorBodyServer(errorBodyRetries + 1)
+	defer server.Close()
+
+	var c hnComment
+	_, err := fetchObject(context.Background(), server.URL, &c)
+	var bodyErr *errorBodyError
+	if !errors.As(err, &bodyErr) {
+		t.Fatalf("fetchObject returned %v, want an *errorBodyError", err)
+	}
+	if *requests != errorBodyRetries+1 {
+		t.Errorf("sent %d requests, want %d", *requests, errorBodyRetries+1)
+	}
+}
+
+func TestFetchFromFile(t *testing.T) {
+	want := []hnComment{{By: "alice", ID: 1, Parent: 100}, {By: "bob", ID: 2, Parent: 100}}
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"array", `[{"by":"alice","id":1,"parent":100},{"by":"bob","id":2,"parent":100}]`},
+		{"jsonl", "{\"by\":\"alice\",\"id\":1,\"parent\":100}\n{\"by\":\"bob\",\"id\":2,\"parent\":100}\n"},
+	}
+	for _, test := range tests {
+		comments, err := fetchFromFile(strings.NewReader(test.file))
+		if err != nil {
+			t.Errorf("%s: fetchFromFile failed: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(comments, want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, comments, want)
+		}
+	}
+
+	if _, err := fetchFromFile(strings.NewReader(`[{"by":"alice","id":1,"parent":100},{"by":"bo`)); err == nil {
+		t.Error("fetchFromFile of a truncated array didn't fail")
+	}
+}
+
+//Serves threadID with the comments 1 and 2 as apiBase for the duration of the test
+func serveThread(t *testing.T, threadID int) {
+	items := map[string]string{
+		fmt.Sprintf("/v0/item/%d.json", threadID): fmt.Sprintf(`{"by":"whoishiring","id":%d,"kids":[1,2],"type":"story"}`, threadID),
+		"/v0/item/1.json":                         fmt.Sprintf(`{"by":"alice","id":1,"parent":%d,"text":"Acme"}`, threadID),
+		"/v0/item/2.json":                         fmt.Sprintf(`{"by":"bob","id":2,"parent":%d,"text":"Beta"}`, threadID),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		item, ok := items[r.URL.Path]
+		if !ok {
+			item = "null"
+		}
+		fmt.Fprint(w, item)
+	}))
+	base := apiBase
+	apiBase = server.URL + "/v0"
+	t.Cleanup(func() {
+		apiBase = base
+		server.Close()
+	})
+}
+
+//Points cacheDir at a temporary directory for the duration of the test
+func useTempCacheDir(t *testing.T) {
+	dir := cacheDirOverride
+	cacheDirOverride = t.TempDir()
+	t.Cleanup(func() { cacheDirOverride = dir })
+}
+
+func TestGetCommentsRefetchesTruncatedCache(t *testing.T) {
+	const threadID = 100
+	serveThread(t, threadID)
+	useTempCacheDir(t)
+	policy := cachePolicy{format: cacheFormatArray}
+	cachedFileName := policy.cacheFile(threadID)
+	if err := ioutil.WriteFile(cachedFileName, []byte(`[{"by":"alice","id":1,"parent":100,"te`), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	comments, source := getComments(context.Background(), threadID, policy)
+	if source.Kind != "api" {
+		t.Errorf("read the comments from the %s, want them refetched", source.Kind)
+	}
+	if len(comments) != 2 {
+		t.Errorf("got %d comments, want 2", len(comments))
+	}
+
+	cached, err := readCommentsFile(cachedFileName)
+	if err != nil {
+		t.Fatalf("the cache is still corrupt: %v", err)
+	}
+	if !reflect.DeepEqual(cached, comments) {
+		t.Errorf("cached %+v, want %+v", cached, comments)
+	}
+}
+
+func TestLargeIDs(t *testing.T) {
+	//Above 2^53, where float64 can't represent every integer anymore
+	const id = int64(1)<<53 + 1
+	c := hnComment{By: "alice", ID: id, Parent: id - 2, Kids: []int64{id + 2, id + 4}}
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(encoded), `"id":9007199254740993`) {
+		t.Errorf("encoded %s", encoded)
+	}
+	var decoded hnComment
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, c) {
+		t.Errorf("round trip gave %+v, want %+v", decoded, c)
+	}
+
+	comments, err := fetchFromFile(strings.NewReader(`[{"by":"alice","id":9007199254740993,"parent":9007199254740991}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comments[0].ID != id || comments[0].Parent != id-2 {
+		t.Errorf("decoded %+v", comments[0])
+	}
+}
+
+//Caches written while IDs were float64 encoded them like integers, which still decode
+func TestFloatEraCache(t *testing.T) {
+	old := []struct {
+		By     string    `json:"by"`
+		ID     float64   `json:"id"`
+		Parent float64   `json:"parent"`
+		Kids   []float64 `json:"kids"`
+	}{{By: "alice", ID: 38490000, Parent: 38480000, Kids: []float64{38490001}}}
+	encoded, err := json.Marshal(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comments, err := fetchFromFile(strings.NewReader(string(encoded)))
+	if err != nil {
+		t.Fatalf("fetchFromFile(%s) failed: %v", encoded, err)
+	}
+	want := []hnComment{{By: "alice", ID: 38490000, Parent: 38480000, Kids: []int64{38490001}}}
+	if !reflect.DeepEqual(comments, want) {
+		t.Errorf("got %+v, want %+v", comments, want)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+//The tool version recorded in manifests. Release builds set it with
+//-ldflags "-X main.version=v1.2.3", otherwise the module version or VCS revision is used if known
+var version = ""
+
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	if info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "unknown"
+}
+
+//Where a run's comments came from
+type commentSource struct {
+	//cache, api, file or commentIDs
+	Kind string `json:"kind"`
+	//The file read for the cache and file kinds
+	Path string `json:"path,omitempty"`
+	//When the cache file was written
+	CachedAt *time.Time `json:"cachedAt,omitempty"`
+}
+
+//A record of what a run did, written by -manifest so a scrape can be audited or reproduced
+type runManifest struct {
+	Version    string            `json:"version"`
+	StartedAt  time.Time         `json:"startedAt"`
+	FinishedAt time.Time         `json:"finishedAt"`
+	Args       []string          `json:"args"`
+	Flags      map[string]string `json:"flags"`
+	ThreadIDs  []int             `json:"threadIDs,omitempty"`
+	Source     commentSource     `json:"source"`
+	Counts     struct {
+		Loaded int `json:"loaded"`
+		Failed int `json:"failed"`
+		Output int `json:"output"`
+	} `json:"counts"`
+	//The number of requests each -apiMirrors mirror answered after -apiBase failed
+	Mirrors map[string]int `json:"mirrors,omitempty"`
+}
+
+//Returns a manifest for a run that started at startedAt with the flags that were set explicitly
+func newRunManifest(startedAt time.Time) *runManifest {
+	m := &runManifest{
+		Version:   toolVersion(),
+		StartedAt: startedAt,
+		Args:      redactArgs(os.Args[1:]),
+		Flags:     make(map[string]string),
+	}
+	flag.Visit(func(f *flag.Flag) {
+		value := f.Value.String()
+		if secretFlags[f.Name] && value != "" {
+			value = "***"
+		}
+		m.Flags[f.Name] = value
+	})
+	return m
+}
+
+//Returns a copy of args with the values of secretFlags masked, whether they're given as
+//-name=value or as the argument after -name
+func redactArgs(args []string) []string {
+	redacted := append([]string{}, args...)
+	for i := 0; i < len(redacted); i++ {
+		arg := redacted[i]
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		if eq := strings.Index(name, "="); eq >= 0 {
+			if secretFlags[name[:eq]] {
+				redacted[i] = arg[:len(arg)-len(name)+eq+1] + "***"
+			}
+		} else if secretFlags[name] && i+1 < len(redacted) {
+			i++
+			redacted[i] = "***"
+		}
+	}
+	return redacted
+}
+
+func (m *runManifest) write(filename string) error {
+	m.FinishedAt = time.Now()
+	return writeJSONAtomic(filename, m)
+}
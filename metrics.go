@@ -0,0 +1,25 @@
+package main
+
+import "time"
+
+//Records what the fetch path does. The default implementation discards everything, building with
+//the prometheus tag replaces it with one that's exported through -metricsAddr
+type fetchMetrics interface {
+	//Records an HTTP request to the HN API that took d and failed with err if it's non-nil
+	fetched(d time.Duration, err error)
+	//Records a lookup in the thread or comment cache
+	cacheLookup(cache string, hit bool)
+}
+
+type noMetrics struct{}
+
+func (noMetrics) fetched(time.Duration, error) {}
+
+func (noMetrics) cacheLookup(string, bool) {}
+
+var metrics fetchMetrics = noMetrics{}
+
+//Serves the recorded metrics at http://addr/metrics in the background for as long as the run lasts,
+//since there's no long-running server mode to attach them to. Only set when built with the
+//prometheus tag so the client library isn't a dependency of the default build
+var serveMetrics func(addr string)
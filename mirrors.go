@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+//Base URLs of HN API mirrors that requests to apiBase fail over to in order, -apiMirrors
+var apiMirrors []string
+
+//Fetches url like fetchOnce. If url is on apiBase and the request fails or the server errors, the
+//same path is requested from each mirror in turn and the first answer is returned. If every
+//mirror fails too the error of apiBase is returned
+func fetchResponse(ctx context.Context, url string, header http.Header) (*http.Response, []byte, error) {
+	response, body, err := fetchOnce(ctx, url, header)
+	if !needsFailover(ctx, response, err) || !strings.HasPrefix(url, apiBase) {
+		return response, body, err
+	}
+
+	path := strings.TrimPrefix(url, apiBase)
+	for _, mirror := range apiMirrors {
+		mirrorResponse, mirrorBody, mirrorErr := fetchOnce(ctx, mirror+path, header)
+		if !needsFailover(ctx, mirrorResponse, mirrorErr) {
+			mirrorUses.add(mirror)
+			return mirrorResponse, mirrorBody, mirrorErr
+		}
+	}
+	return response, body, err
+}
+
+//Reports whether a request failed in a way another server might not, a network error or a
+//server error. Cancellation isn't retried elsewhere
+func needsFailover(ctx context.Context, response *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil
+	}
+	return response.StatusCode >= http.StatusInternalServerError
+}
+
+//Counts the requests answered by each mirror
+type mirrorStats struct {
+	mu   sync.Mutex
+	uses map[string]int
+}
+
+var mirrorUses = &mirrorStats{}
+
+//Records that mirror answered a request, logging the first time it does
+func (s *mirrorStats) add(mirror string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.uses == nil {
+		s.uses = make(map[string]int)
+	}
+	if s.uses[mirror] == 0 {
+		log.Printf("%s failed, using the mirror %s", apiBase, mirror)
+	}
+	s.uses[mirror]++
+}
+
+func (s *mirrorStats) snapshot() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.uses) == 0 {
+		return nil
+	}
+	uses := make(map[string]int, len(s.uses))
+	for mirror, n := range s.uses {
+		uses[mirror] = n
+	}
+	return uses
+}
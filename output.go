@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Output formats for -format
+const (
+	formatJSON     = "json"
+	formatBlob     = "blob"
+	formatMarkdown = "markdown"
+	formatNDJSON   = "ndjson"
+	formatRSS      = "rss"
+	formatAtom     = "atom"
+	//A CSV of the extracted fields of every comment, see writeSummaryCSV
+	formatSummaryCSV = "summary-csv"
+	formatDOT        = "dot"
+)
+
+const permalinkToFormat = "https://news.ycombinator.com/item?id=%d"
+
+//Returns the HN page of the item with id
+func permalink(id int64) string {
+	return fmt.Sprintf(permalinkToFormat, id)
+}
+
+//Returns the file extension for files written in format
+func formatExtension(format string) string {
+	switch format {
+	case formatBlob:
+		return ".txt"
+	case formatMarkdown:
+		return ".md"
+	case formatNDJSON:
+		return ".ndjson"
+	case formatRSS, formatAtom:
+		return ".xml"
+	case formatSummaryCSV:
+		return ".csv"
+	case formatDOT:
+		return ".dot"
+	default:
+		return ".json"
+	}
+}
+
+func validateFormat(format string) error {
+	switch format {
+	case formatJSON, formatBlob, formatMarkdown, formatNDJSON, formatRSS, formatAtom, formatSummaryCSV, formatDOT:
+		return nil
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+//How writeComments formats comments
+type outputOptions struct {
+	format string
+	//Nest replies under their parents in JSON output, the other formats are always flat
+	tree bool
+	//Highlight extracted fields with ANSI colors in text output
+	color bool
+	//Append an index of the extracted links to the markdown report
+	linkIndex bool
+	//Wrap JSON output in an object with the comments under this key instead of a bare array
+	rootKey string
+	//Group the comments by this field instead of listing them, see groupCommentsByTag
+	groupBy string
+	//The most comments written per group
+	groupLimit int
+	//Write the distinct authors of the comments instead, sorted by authorsSort, see countAuthors
+	authorsOnly bool
+	authorsSort string
+	//Flush ndjson output after every flushEvery lines if the writer is buffered, 0 only flushes
+	//when it's closed
+	flushEvery int
+	//Leave the parent field out of flat JSON and ndjson output, trees are nested by parent instead
+	noParent bool
+	//Written before the comments, see -story-header. JSON output needs a rootKey to hold the
+	//comments next to the story
+	story *storyHeader
+	//Write the comments that failed the filter as a second section after the ones passed in,
+	//see writeSections
+	showUnmatched bool
+	unmatched     []hnComment
+	//How links in the text of blob and markdown output are rendered, see stripHTML
+	linkStyle string
+}
+
+//A buffered writer whose buffer can be written out before it's full
+type flusher interface {
+	Flush() error
+}
+
+//Writes comments to w
+func writeComments(w io.Writer, comments []hnComment, options outputOptions) error {
+	if options.authorsOnly {
+		return writeAuthors(w, countAuthors(comments, options.authorsSort), options.format)
+	}
+	if options.groupBy == groupByTag {
+		return writeGroups(w, groupCommentsByTag(comments, options.groupLimit), options)
+	}
+	if options.showUnmatched {
+		return writeSections(w, matchSections{Matched: comments, Unmatched: options.unmatched}, options)
+	}
+	if options.story != nil {
+		switch options.format {
+		case formatBlob, formatMarkdown:
+			if err := writeStoryHeader(w, options.story, options.format); err != nil {
+				return err
+			}
+		case formatNDJSON:
+			if err := json.NewEncoder(w).Encode(map[string]interface{}{"story": options.story}); err != nil {
+				return err
+			}
+		}
+	}
+	switch options.format {
+	case formatBlob:
+		return writeBlob(w, comments, options.color, options.linkStyle)
+	case formatMarkdown:
+		return writeMarkdown(w, comments, options.linkIndex, options.linkStyle)
+	case formatNDJSON:
+		return writeNDJSON(w, comments, options)
+	case formatRSS:
+		return writeRSS(w, comments, options.story)
+	case formatAtom:
+		return writeAtom(w, comments, options.story)
+	case formatSummaryCSV:
+		return writeSummaryCSV(w, comments)
+	case formatDOT:
+		return writeDOT(w, comments)
+	default:
+		var output interface{} = comments
+		if options.tree {
+			output = buildTree(comments)
+		} else if options.noParent {
+			output = withoutParents(comments)
+		}
+		if options.story != nil {
+			output = storyDocument{story: options.story, key: options.rootKey, comments: output}
+		} else if options.rootKey != "" {
+			output = map[string]interface{}{options.rootKey: output}
+		}
+		return json.NewEncoder(w).Encode(output)
+	}
+}
+
+//A comment encoded without its parent field. The empty Parent shadows the embedded one
+type parentlessComment struct {
+	hnComment
+	Parent *struct{} `json:"parent,omitempty"`
+}
+
+func withoutParents(comments []hnComment) []interface{} {
+	parentless := make([]interface{}, len(comments))
+	for i, c := range comments {
+		parentless[i] = parentlessComment{hnComment: c}
+	}
+	return parentless
+}
+
+//Writes one JSON object per line, each comment or with tree each top level comment and its replies.
+//If w is buffered it's flushed every options.flushEvery lines so consumers reading the output as
+//it's written get them promptly
+func writeNDJSON(w io.Writer, comments []hnComment, options outputOptions) error {
+	tree, flushEvery := options.tree, options.flushEvery
+	var lines []interface{}
+	if tree {
+		for _, node := range buildTree(comments) {
+			lines = append(lines, node)
+		}
+	} else if options.noParent {
+		lines = withoutParents(comments)
+	} else {
+		for _, c := range comments {
+			lines = append(lines, c)
+		}
+	}
+
+	f, buffered := w.(flusher)
+	encoder := json.NewEncoder(w)
+	for i, line := range lines {
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+		if buffered && flushEvery > 0 && (i+1)%flushEvery == 0 {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//Writes the plain text of every comment as one document for text processing tools. Each comment
+//is preceded by a header line with its permalink and author and followed by a blank line. If
+//fields were extracted they're summarized in the header and, with color, highlighted in the text
+func writeBlob(w io.Writer, comments []hnComment, color bool, linkStyle string) error {
+	for _, c := range comments {
+		text := stripHTML(c.Text, linkStyle)
+		if color {
+			text = highlightExtracted(text, c)
+		}
+		_, err := fmt.Fprintf(w, "==== %s by %s%s%s ====\n%s\n\n", permalink(c.ID), c.By, opMarker(c), extractedSummary(c), text)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Returns " [OP]" if c was written by the author of its thread
+func opMarker(c hnComment) string {
+	if c.IsOP {
+		return " [OP]"
+	}
+	return ""
+}
+
+//Returns a summary like " [Acme | remote | $120k]" of the fields extracted from c
+func extractedSummary(c hnComment) string {
+	var fields []string
+	for _, field := range []string{c.Company, c.Remote, c.Salary} {
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(fields, " | ") + "]"
+}
+
+//Colors the occurrences of c's company, remote status and salary in text
+func highlightExtracted(text string, c hnComment) string {
+	text = colorize(text, c.Company, colorCompany)
+	if c.Remote != "" {
+		text = colorizePattern(text, remotePattern, colorRemote)
+	}
+	text = colorize(text, c.Salary, colorSalary)
+	return text
+}
+
+//Writes comments as a markdown report with a section per comment. With linkIndex the report ends
+//with an index of the unique extracted links, how many comments share each one and the companies
+//that posted them
+func writeMarkdown(w io.Writer, comments []hnComment, linkIndex bool, linkStyle string) error {
+	var b strings.Builder
+	for _, c := range comments {
+		title := c.By + opMarker(c)
+		if c.Company != "" {
+			title = c.Company + " (" + c.By + ")" + opMarker(c)
+		}
+		fmt.Fprintf(&b, "## [%s](%s)\n\n%s\n\n", title, permalink(c.ID), stripHTML(c.Text, linkStyle))
+	}
+
+	if linkIndex {
+		b.WriteString("## Link index\n\n| Link | Comments | Companies |\n| --- | --- | --- |\n")
+		for _, entry := range buildLinkIndex(comments) {
+			fmt.Fprintf(&b, "| %s | %d | %s |\n", entry.link, entry.count, strings.Join(entry.companies, ", "))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type linkIndexEntry struct {
+	link      string
+	count     int
+	companies []string
+}
+
+//Groups the extracted links of comments, most shared first and alphabetically among equals
+func buildLinkIndex(comments []hnComment) []*linkIndexEntry {
+	entries := make(map[string]*linkIndexEntry)
+	for _, c := range comments {
+		for _, link := range normalizeExtracted(c.Links, false) {
+			entry, ok := entries[link]
+			if !ok {
+				entry = &linkIndexEntry{link: link}
+				entries[link] = entry
+			}
+			entry.count++
+			if c.Company != "" && !containsString(entry.companies, c.Company) {
+				entry.companies = append(entry.companies, c.Company)
+			}
+		}
+	}
+
+	index := make([]*linkIndexEntry, 0, len(entries))
+	for _, entry := range entries {
+		index = append(index, entry)
+	}
+	sort.Slice(index, func(i, j int) bool {
+		if index[i].count != index[j].count {
+			return index[i].count > index[j].count
+		}
+		return index[i].link < index[j].link
+	})
+	return index
+}
+
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
+
+//Writes each comment to its own file in dir named after its ID, <dir>/<ID>.json or the extension
+//of the format. JSON files hold a single comment object. With keepExisting files that already
+//exist are left as they are. Returns the number of files written
+func explodeComments(dir string, comments []hnComment, options outputOptions, keepExisting bool) (int, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return 0, err
+	}
+	written := 0
+	for _, c := range comments {
+		name := filepath.Join(dir, strconv.FormatInt(c.ID, 10)+formatExtension(options.format))
+		if keepExisting && fileExists(name) {
+			continue
+		}
+		file, err := os.Create(name)
+		if err != nil {
+			return written, err
+		}
+		if options.format == formatJSON {
+			var v interface{} = c
+			if options.noParent {
+				v = withoutParents([]hnComment{c})[0]
+			}
+			err = json.NewEncoder(file).Encode(v)
+		} else {
+			err = writeComments(file, []hnComment{c}, options)
+		}
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return written, fmt.Errorf("writing %s: %v", name, err)
+		}
+		written++
+	}
+	return written, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	progressBarWidth       = 40
+	progressRedrawInterval = 200 * time.Millisecond
+	progressLogInterval    = 5 * time.Second
+)
+
+//Reports the progress of fetching comments. On a terminal it redraws a progress bar with the
+//number of in-flight requests and the request rate, otherwise it logs a line periodically
+type progress struct {
+	total    int
+	inFlight int64
+	finished int64
+	failed   int64
+	begin    time.Time
+	out      *os.File
+	tty      bool
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+//Starts reporting progress of fetching total comments to out
+func newProgress(total int, out *os.File) *progress {
+	p := &progress{
+		total:   total,
+		begin:   time.Now(),
+		out:     out,
+		tty:     isTerminal(out),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+//Records that a request was sent
+func (p *progress) requestStarted() {
+	atomic.AddInt64(&p.inFlight, 1)
+}
+
+//Records that a request completed
+func (p *progress) requestFinished(err error) {
+	atomic.AddInt64(&p.inFlight, -1)
+	p.commentDone(err)
+}
+
+//Records that a comment failed before its request was sent, e.g. because ctx was done while it
+//waited for the rate limiter
+func (p *progress) requestSkipped(err error) {
+	p.commentDone(err)
+}
+
+func (p *progress) commentDone(err error) {
+	if err != nil {
+		atomic.AddInt64(&p.failed, 1)
+	}
+	atomic.AddInt64(&p.finished, 1)
+}
+
+//Stops reporting and prints the final state
+func (p *progress) Stop() {
+	close(p.stop)
+	<-p.stopped
+}
+
+func (p *progress) run() {
+	defer close(p.stopped)
+	interval := progressLogInterval
+	if p.tty {
+		interval = progressRedrawInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.report()
+		case <-p.stop:
+			p.report()
+			if p.tty {
+				fmt.Fprintln(p.out)
+			}
+			return
+		}
+	}
+}
+
+func (p *progress) report() {
+	finished := atomic.LoadInt64(&p.finished)
+	inFlight := atomic.LoadInt64(&p.inFlight)
+	failed := atomic.LoadInt64(&p.failed)
+	rate := float64(finished) / time.Since(p.begin).Seconds()
+
+	if !p.tty {
+		log.Printf("Fetched %d/%d comments (%d failed, %d in flight, %.1f req/s)",
+			finished, p.total, failed, inFlight, rate)
+		return
+	}
+
+	filled := progressBarWidth
+	if p.total > 0 {
+		filled = int(finished) * progressBarWidth / p.total
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	fmt.Fprintf(p.out, "\r[%s] %d/%d  %d failed  %d in flight  %.1f req/s ",
+		bar, finished, p.total, failed, inFlight, rate)
+}
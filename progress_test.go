@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressCancelWhileRateLimited(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	out, err := os.Create(filepath.Join(t.TempDir(), "progress"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	//No request is allowed before the deadline, so every comment fails waiting on the limiter
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	comments := fetchComments(ctx, []int64{1, 2, 3}, withRateLimit(0.1), withProgress(out))
+	if len(comments) != 0 {
+		t.Errorf("fetched %d comments", len(comments))
+	}
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	last := lines[len(lines)-1]
+	if !strings.Contains(last, "Fetched 3/3 comments (3 failed, 0 in flight") {
+		t.Errorf("the final progress is %q, want 3 failed and 0 in flight", last)
+	}
+}
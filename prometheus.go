@@ -0,0 +1,67 @@
+//go:build prometheus
+// +build prometheus
+
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type prometheusMetrics struct {
+	fetches      *prometheus.CounterVec
+	fetchLatency prometheus.Histogram
+	cacheLookups *prometheus.CounterVec
+}
+
+func init() {
+	m := &prometheusMetrics{
+		fetches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "hn_fetches_total",
+			Help: "Requests made to the HN API by result",
+		}, []string{"result"}),
+		fetchLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "hn_fetch_duration_seconds",
+			Help:    "Latency of requests made to the HN API",
+			Buckets: prometheus.DefBuckets,
+		}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "hn_cache_lookups_total",
+			Help: "Thread and comment cache lookups by cache and result",
+		}, []string{"cache", "result"}),
+	}
+	prometheus.MustRegister(m.fetches, m.fetchLatency, m.cacheLookups)
+
+	metrics = m
+	serveMetrics = func(addr string) {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		go func() {
+			log.Println("Serving metrics at", addr+"/metrics")
+			if err := http.ListenAndServe(addr, mux); err != nil {
+				log.Println("Metrics server stopped:", err)
+			}
+		}()
+	}
+}
+
+func (m *prometheusMetrics) fetched(d time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.fetches.WithLabelValues(result).Inc()
+	m.fetchLatency.Observe(d.Seconds())
+}
+
+func (m *prometheusMetrics) cacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.WithLabelValues(cache, result).Inc()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+//The filter -check-query parsed from -keywords and the flags that change how they match
+type queryCheck struct {
+	Keywords []string `json:"keywords"`
+	//The number of distinct keywords a comment has to contain, 0 without keywords
+	MinMatches int  `json:"minMatches"`
+	Invert     bool `json:"invert,omitempty"`
+	AnyField   bool `json:"anyField,omitempty"`
+}
+
+//Reports queries that are valid but can't keep any comment
+func (q queryCheck) validate() error {
+	if q.MinMatches > len(q.Keywords) {
+		return fmt.Errorf("the keywords can never match, %d of them are required but there are only %d",
+			q.MinMatches, len(q.Keywords))
+	}
+	if len(q.Keywords) == 0 && q.Invert {
+		return errors.New("-invert without -keywords leaves out every comment")
+	}
+	return nil
+}
+
+//Writes the parsed query as indented JSON to w, or returns why it can't match
+func (q queryCheck) write(w io.Writer) error {
+	if err := q.validate(); err != nil {
+		return err
+	}
+	if q.Keywords == nil {
+		q.Keywords = []string{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(q)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Features -rankBy can score comments on. Each is between 0 and 1
+const (
+	//Keyword occurrences per word, reaching 1 at one in every densityScale words
+	featureDensity = "density"
+	//The number of words, reaching 1 at lengthScale words
+	featureLength = "length"
+	featureLinks  = "links"
+	featureEmails = "emails"
+	featureSalary = "salary"
+	featureRemote = "remote"
+)
+
+const (
+	densityScale = 10
+	lengthScale  = 300
+)
+
+//A feature and how much it counts towards the score
+type rankWeight struct {
+	feature string
+	weight  float64
+}
+
+//Parses a -rankBy value, comma-separated features each with an optional weight after a colon,
+//e.g. "density:2,length,salary:0.5". Features without a weight count 1
+func parseRankBy(s string) ([]rankWeight, error) {
+	var weights []rankWeight
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		feature, weightStr := field, ""
+		if i := strings.Index(field, ":"); i != -1 {
+			feature, weightStr = field[:i], field[i+1:]
+		}
+		switch feature {
+		case featureDensity, featureLength, featureLinks, featureEmails, featureSalary, featureRemote:
+		default:
+			return nil, fmt.Errorf("unknown ranking feature %q, expected density, length, links, emails, salary or remote", feature)
+		}
+		w := rankWeight{feature: feature, weight: 1}
+		if weightStr != "" {
+			weight, err := strconv.ParseFloat(weightStr, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid weight for %s: %q", feature, weightStr)
+			}
+			w.weight = weight
+		}
+		weights = append(weights, w)
+	}
+	if len(weights) == 0 {
+		return nil, fmt.Errorf("no ranking features in %q", s)
+	}
+	return weights, nil
+}
+
+//Reports whether any of the weights uses an extracted field
+func rankNeedsExtract(weights []rankWeight) bool {
+	for _, w := range weights {
+		switch w.feature {
+		case featureLinks, featureEmails, featureSalary, featureRemote:
+			return true
+		}
+	}
+	return false
+}
+
+//Returns the weighted sum of c's features. Links, emails, salary and remote need c to be extracted
+func rankScore(c hnComment, keywords []string, weights []rankWeight) float64 {
+	words := strings.Fields(strings.ToLower(stripHTML(c.Text, linkText)))
+	score := 0.0
+	for _, w := range weights {
+		var value float64
+		switch w.feature {
+		case featureDensity:
+			value = keywordDensity(words, keywords)
+		case featureLength:
+			value = math.Min(1, float64(len(words))/lengthScale)
+		case featureLinks:
+			value = presence(len(c.Links) > 0)
+		case featureEmails:
+			value = presence(len(c.Emails) > 0)
+		case featureSalary:
+			value = presence(c.Salary != "")
+		case featureRemote:
+			value = presence(c.Remote != "")
+		}
+		score += w.weight * value
+	}
+	return score
+}
+
+//Returns how densely keywords occur in words, see featureDensity
+func keywordDensity(words, keywords []string) float64 {
+	if len(words) == 0 || len(keywords) == 0 {
+		return 0
+	}
+	text := strings.Join(words, " ")
+	occurrences := 0
+	for _, keyword := range keywords {
+		occurrences += strings.Count(text, keyword)
+	}
+	return math.Min(1, float64(occurrences)*densityScale/float64(len(words)))
+}
+
+func presence(present bool) float64 {
+	if present {
+		return 1
+	}
+	return 0
+}
+
+//Scores comments and sorts them by score, highest first. Comments with the same score keep
+//their order
+func rankComments(comments []hnComment, keywords []string, weights []rankWeight) {
+	for i := range comments {
+		score := math.Round(rankScore(comments[i], keywords, weights)*1000) / 1000
+		comments[i].Score = &score
+	}
+	sort.SliceStable(comments, func(i, j int) bool {
+		return *comments[i].Score > *comments[j].Score
+	})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Spaces out requests to at most a number per second. A nil *rateLimiter doesn't limit
+type rateLimiter struct {
+	ticker *time.Ticker
+}
+
+//Returns a limiter allowing rps requests per second, nil if rps is 0 or less. Rates above one
+//request per nanosecond are capped at that
+func newRateLimiter(rps float64) *rateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	interval := time.Duration(float64(time.Second) / rps)
+	if interval <= 0 {
+		interval = time.Nanosecond
+	}
+	return &rateLimiter{ticker: time.NewTicker(interval)}
+}
+
+//Blocks until the next request is allowed or ctx is done
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case <-l.ticker.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *rateLimiter) Stop() {
+	if l != nil {
+		l.ticker.Stop()
+	}
+}
+
+//How often a ramp releases the requests it has come to allow
+const rampStep = 10 * time.Millisecond
+
+//Caps the number of requests in flight, starting at one and growing evenly to size over a warm-up
+//period, so a run doesn't open every request in its first moment. A nil *ramp doesn't cap anything
+type ramp struct {
+	slots chan struct{}
+}
+
+//Returns a ramp to size requests over period, nil if period is 0 or less. It stops growing when ctx
+//is done
+func newRamp(ctx context.Context, size int, period time.Duration) *ramp {
+	if period <= 0 || size <= 0 {
+		return nil
+	}
+	r := &ramp{slots: make(chan struct{}, size)}
+	r.slots <- struct{}{}
+	go func() {
+		start := time.Now()
+		ticker := time.NewTicker(rampStep)
+		defer ticker.Stop()
+		for released := 1; released < size; {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			allowed := size
+			if elapsed := time.Since(start); elapsed < period {
+				allowed = int(int64(size) * int64(elapsed) / int64(period))
+			}
+			for ; released < allowed; released++ {
+				r.slots <- struct{}{}
+			}
+		}
+	}()
+	return r
+}
+
+//Blocks until another request may start or ctx is done. Call release when the request is done
+func (r *ramp) acquire(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	select {
+	case <-r.slots:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *ramp) release() {
+	if r != nil {
+		r.slots <- struct{}{}
+	}
+}
+
+//A thread listed in -threadsFile, with the rate its comments are fetched at. An rps of 0 uses -rps
+type threadSpec struct {
+	ID  int
+	rps float64
+}
+
+//Reads a -threadsFile: one thread ID per line, optionally followed by a comma and the requests per
+//second to fetch its comments at. Blank lines and lines starting with # are ignored
+func readThreadsFile(filename string) ([]threadSpec, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var threads []threadSpec
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("%s:%d: expected a thread ID and an optional rps, got %q", filename, line, text)
+		}
+		var spec threadSpec
+		if spec.ID, err = strconv.Atoi(strings.TrimSpace(fields[0])); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid thread ID: %v", filename, line, err)
+		}
+		if len(fields) == 2 {
+			if spec.rps, err = strconv.ParseFloat(strings.TrimSpace(fields[1]), 64); err != nil || spec.rps < 0 {
+				return nil, fmt.Errorf("%s:%d: invalid rps %q", filename, line, fields[1])
+			}
+		}
+		threads = append(threads, spec)
+	}
+	return threads, scanner.Err()
+}
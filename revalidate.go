@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+//The HTTP validators of a thread item response. They're stored next to the thread cache so an
+//expired cache can be revalidated with one conditional request instead of refetching every comment
+type cacheValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+func validatorsFromHeader(header http.Header) cacheValidators {
+	return cacheValidators{ETag: header.Get("ETag"), LastModified: header.Get("Last-Modified")}
+}
+
+//Returns the request headers that make a request conditional on the validators
+func (v cacheValidators) header() http.Header {
+	header := http.Header{}
+	if v.ETag != "" {
+		header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		header.Set("If-Modified-Since", v.LastModified)
+	}
+	return header
+}
+
+//Returns the file the validators of a thread cache are stored in, one per cache variant of p
+func (p cachePolicy) validatorsFile(threadID int) string {
+	return strings.TrimSuffix(p.cacheFile(threadID), ".json") + ".validators.json"
+}
+
+//Stores v in filename, removing the file if the server sent no validators
+func writeValidators(filename string, v cacheValidators) error {
+	if v == (cacheValidators{}) {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return writeJSONAtomic(filename, v)
+}
+
+func readValidators(filename string) (cacheValidators, error) {
+	var v cacheValidators
+	file, err := os.Open(filename)
+	if err != nil {
+		return v, err
+	}
+	defer file.Close()
+	return v, json.NewDecoder(file).Decode(&v)
+}
+
+//Fetches the thread item at url along with the validators of the response
+func getThreadWithValidators(ctx context.Context, url string) (*hnThread, cacheValidators, error) {
+	response, body, err := fetchResponse(ctx, url, nil)
+	if err != nil {
+		return nil, cacheValidators{}, err
+	}
+	thread := &hnThread{}
+	if err := decodeObject(url, body, thread); err != nil {
+		return nil, cacheValidators{}, err
+	}
+	return thread, validatorsFromHeader(response.Header), nil
+}
+
+//The wait before the first retry of the thread item, doubled on every retry after it
+const threadRetryBackoff = time.Second
+
+//Fetches the thread item at url like getThreadWithValidators, retrying up to retries times. Items
+//that aren't objects, e.g. null for a thread that doesn't exist, and requests cut short by ctx
+//aren't retried
+func getThreadWithRetries(ctx context.Context, url string, retries int) (*hnThread, cacheValidators, error) {
+	backoff := threadRetryBackoff
+	for attempt := 0; ; attempt++ {
+		thread, validators, err := getThreadWithValidators(ctx, url)
+		var shapeErr *unexpectedShapeError
+		if err == nil || attempt >= retries || errors.As(err, &shapeErr) || ctx.Err() != nil {
+			if err != nil && attempt > 0 {
+				err = fmt.Errorf("%v (after %d attempts)", err, attempt+1)
+			}
+			return thread, validators, err
+		}
+		log.Printf("Fetching thread failed, retrying in %s: %v", backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, cacheValidators{}, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+//Sends a conditional request for the thread item with the validators stored for its cache in the
+//variant of policy. Reports whether the server answered 304 Not Modified, false if there are no
+//validators or the request fails
+func threadUnchanged(ctx context.Context, threadID int, policy cachePolicy) bool {
+	v, err := readValidators(policy.validatorsFile(threadID))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("Couldn't read the cache validators:", err)
+		}
+		return false
+	}
+
+	url := itemURL(int64(threadID))
+	response, _, err := fetchResponse(ctx, url, v.header())
+	if err != nil {
+		log.Println("Couldn't revalidate the cache:", err)
+		return false
+	}
+	return response.StatusCode == http.StatusNotModified
+}
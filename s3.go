@@ -0,0 +1,50 @@
+//go:build s3
+// +build s3
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func init() {
+	uploadToS3 = putS3Object
+}
+
+//Uploads body to s3://bucket/prefix/name. Credentials and region come from the standard AWS
+//environment variables, shared config files or instance role
+func putS3Object(ctx context.Context, dest, name string, body []byte) error {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return fmt.Errorf("invalid S3 location %q, expected s3://bucket/prefix/", dest)
+	}
+	key := path.Join(strings.TrimPrefix(u.Path, "/"), name)
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = s3.NewFromConfig(cfg).PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(u.Host),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(mime.TypeByExtension(path.Ext(name))),
+	})
+	if err != nil {
+		return fmt.Errorf("uploading to s3://%s/%s: %v", u.Host, key, err)
+	}
+	return nil
+}
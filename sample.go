@@ -0,0 +1,27 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+//Returns percent percent of comments picked at random with rng, rounded to the nearest comment
+//but at least one. The sampled comments keep their order
+func samplePercent(comments []hnComment, percent float64, rng *rand.Rand) []hnComment {
+	if percent >= 100 || len(comments) == 0 {
+		return comments
+	}
+	n := int(math.Round(float64(len(comments)) * percent / 100))
+	if n < 1 {
+		n = 1
+	}
+
+	indices := rng.Perm(len(comments))[:n]
+	sort.Ints(indices)
+	sampled := make([]hnComment, n)
+	for i, index := range indices {
+		sampled[i] = comments[index]
+	}
+	return sampled
+}
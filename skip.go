@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//Reason codes for comments that were left out, as reported in -errorReport and by -explain
+const (
+	reasonFetchError             = "fetch_error"
+	reasonDeleted                = "deleted"
+	reasonFilteredKeyword        = "filtered_keyword"
+	reasonFilteredEmploymentType = "filtered_employment_type"
+	reasonFilteredID             = "filtered_id"
+	reasonFilteredAuthor         = "filtered_author"
+	reasonFilteredSeniority      = "filtered_seniority"
+	reasonFilteredLink           = "filtered_link"
+	reasonFilteredEmail          = "filtered_email"
+	reasonFilteredCommand        = "filtered_command"
+	reasonDuplicateAuthor        = "duplicate_author"
+	reasonDuplicate              = "duplicate"
+	reasonSampledOut             = "sampled_out"
+	reasonTooShort               = "too_short"
+	reasonOverLimit              = "over_limit"
+)
+
+//Records the comments that were left out and why. A nil *skipLog records nothing, so callers
+//don't have to check whether -explain is set. Safe for concurrent use
+type skipLog struct {
+	mu      sync.Mutex
+	skipped []fetchFailure
+}
+
+func (l *skipLog) add(c hnComment, reason string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	log.Printf("Skipping comment %d: %s", c.ID, reason)
+	l.skipped = append(l.skipped, fetchFailure{ID: c.ID, Reason: reason})
+}
+
+//Wraps filter so the comments it drops are recorded with reason, or as deleted if they were
+func (l *skipLog) explain(reason string, filter filterFunction) filterFunction {
+	if l == nil {
+		return filter
+	}
+	return func(c *hnComment) bool {
+		if filter(c) {
+			return true
+		}
+		if c.Deleted {
+			l.add(*c, reasonDeleted)
+		} else {
+			l.add(*c, reason)
+		}
+		return false
+	}
+}
+
+//Records the comments in before that aren't in after with reason
+func (l *skipLog) addDropped(before, after []hnComment, reason string) {
+	if l == nil {
+		return
+	}
+	kept := make(map[int64]bool, len(after))
+	for _, c := range after {
+		kept[c.ID] = true
+	}
+	for _, c := range before {
+		if !kept[c.ID] {
+			l.add(c, reason)
+		}
+	}
+}
+
+//Returns the skipped comments in the order they were skipped
+func (l *skipLog) list() []fetchFailure {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]fetchFailure(nil), l.skipped...)
+}
+
+//Returns the number of comments skipped per reason, e.g. "filtered_keyword: 12, deleted: 3", most
+//common first
+func summarizeSkips(skipped []fetchFailure) string {
+	counts := make(map[string]int)
+	for _, s := range skipped {
+		counts[s.Reason]++
+	}
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if counts[reasons[i]] != counts[reasons[j]] {
+			return counts[reasons[i]] > counts[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	parts := make([]string, len(reasons))
+	for i, reason := range reasons {
+		parts[i] = fmt.Sprintf("%s: %d", reason, counts[reason])
+	}
+	return strings.Join(parts, ", ")
+}
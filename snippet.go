@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	snippetEllipsis  = "..."
+	highlightOpening = "**"
+	highlightClosing = "**"
+)
+
+//Returns the first keyword match in the text of a comment with up to size characters of context on
+//either side, like grep's context lines. The matched term is wrapped in highlight markers and an
+//ellipsis marks text that was cut off. The snippet is cut from the text without its HTML so it
+//can't split a tag or an entity. Returns text unchanged if none of the keywords occur in it
+func snippet(text string, keywords []string, size int) string {
+	plain := stripHTML(text, linkText)
+	lowerText, offsets := lowerWithOffsets(plain)
+	lowerStart, lowerEnd := findKeyword(lowerText, keywords)
+	if lowerStart == -1 {
+		return text
+	}
+	start, end := offsets[lowerStart], offsets[lowerEnd]
+
+	from := start
+	for i := 0; i < size && from > 0; i++ {
+		_, width := utf8.DecodeLastRuneInString(plain[:from])
+		from -= width
+	}
+	to := end
+	for i := 0; i < size && to < len(plain); i++ {
+		_, width := utf8.DecodeRuneInString(plain[to:])
+		to += width
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString(snippetEllipsis)
+	}
+	b.WriteString(plain[from:start])
+	b.WriteString(highlightOpening)
+	b.WriteString(plain[start:end])
+	b.WriteString(highlightClosing)
+	b.WriteString(plain[end:to])
+	if to < len(plain) {
+		b.WriteString(snippetEllipsis)
+	}
+	return b.String()
+}
+
+//Lowercases text like strings.ToLower and returns the offset in text of every byte of the result,
+//plus len(text) for its end, since lowercasing can change the byte length of some runes
+func lowerWithOffsets(text string) (string, []int) {
+	var b strings.Builder
+	offsets := make([]int, 0, len(text)+1)
+	for i, r := range text {
+		n := b.Len()
+		b.WriteRune(unicode.ToLower(r))
+		for j := n; j < b.Len(); j++ {
+			offsets = append(offsets, i)
+		}
+	}
+	return b.String(), append(offsets, len(text))
+}
+
+//Cuts text down to its first n characters, followed by an ellipsis and a note saying how much was
+//cut. Like snippet it cuts the text without its HTML, so no tag is left open and no entity split.
+//Text of at most n characters is returned unchanged
+func truncateText(text string, n int) string {
+	plain := stripHTML(text, linkText)
+	length := utf8.RuneCountInString(plain)
+	if length <= n {
+		return text
+	}
+	end := 0
+	for i := 0; i < n; i++ {
+		_, width := utf8.DecodeRuneInString(plain[end:])
+		end += width
+	}
+	return fmt.Sprintf("%s%s [truncated, %d more characters]", plain[:end], snippetEllipsis, length-n)
+}
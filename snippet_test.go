@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestSnippet(t *testing.T) {
+	tests := []struct {
+		text    string
+		size    int
+		snippet string
+	}{
+		{"Acme is hiring Go engineers in Berlin", 6, "...iring **Go** engin..."},
+		{"<p>Acme | <i>Go</i> | Berlin", 20, "Acme | **Go** | Berlin"},
+		//Text is stored unescaped, so & and < stay as they are
+		{"R&D at Acme, we <3 Go & Rust", 40, "R&D at Acme, we <3 **Go** & Rust"},
+		{"Acme is hiring Rust engineers", 10, "Acme is hiring Rust engineers"},
+	}
+	for _, test := range tests {
+		if got := snippet(test.text, []string{"go"}, test.size); got != test.snippet {
+			t.Errorf("snippet(%q, %d) = %q, want %q", test.text, test.size, got, test.snippet)
+		}
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		text      string
+		n         int
+		truncated string
+	}{
+		{"Acme | Go | Berlin", 18, "Acme | Go | Berlin"},
+		{"Acme | Go | Berlin", 4, "Acme... [truncated, 14 more characters]"},
+		{"<p>Acme | <i>Go</i>", 9, "<p>Acme | <i>Go</i>"},
+		//An entity at the cut counts as the one character it stands for
+		{"Tom &amp; Jerry", 5, "Tom &... [truncated, 6 more characters]"},
+		//Cutting inside a link doesn't leave the anchor open
+		{`Apply at <a href="https://acme.com/jobs">https://acme.com/jobs</a> today`, 15, "Apply at https:... [truncated, 21 more characters]"},
+		{"Zürich, Genève", 6, "Zürich... [truncated, 8 more characters]"},
+	}
+	for _, test := range tests {
+		if got := truncateText(test.text, test.n); got != test.truncated {
+			t.Errorf("truncateText(%q, %d) = %q, want %q", test.text, test.n, got, test.truncated)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+//The story a thread belongs to, written before the comments with -story-header
+type storyHeader struct {
+	ID          int64  `json:"id"`
+	Title       string `json:"title"`
+	URL         string `json:"url,omitempty"`
+	Permalink   string `json:"permalink"`
+	By          string `json:"by"`
+	Score       int    `json:"score"`
+	Descendants int    `json:"descendants"`
+	Time        int64  `json:"time,omitempty"`
+}
+
+func (t *hnThread) storyHeader() *storyHeader {
+	return &storyHeader{
+		ID:          t.ID,
+		Title:       t.Title,
+		URL:         t.URL,
+		Permalink:   permalink(t.ID),
+		By:          t.By,
+		Score:       t.Score,
+		Descendants: t.Descendants,
+		Time:        t.Time,
+	}
+}
+
+//JSON output with -story-header, an object with the story first and the comments under key
+type storyDocument struct {
+	story    *storyHeader
+	key      string
+	comments interface{}
+}
+
+func (d storyDocument) MarshalJSON() ([]byte, error) {
+	story, err := json.Marshal(d.story)
+	if err != nil {
+		return nil, err
+	}
+	key, err := json.Marshal(d.key)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := json.Marshal(d.comments)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `{"story":%s,%s:%s}`, story, key, comments)
+	return b.Bytes(), nil
+}
+
+//Writes the story as the heading of blob and markdown output
+func writeStoryHeader(w io.Writer, story *storyHeader, format string) error {
+	link := story.URL
+	if link == "" {
+		link = story.Permalink
+	}
+	var err error
+	if format == formatMarkdown {
+		_, err = fmt.Fprintf(w, "# [%s](%s)\n\n%d points by %s | %d comments | [discussion](%s)\n\n",
+			story.Title, link, story.Score, story.By, story.Descendants, story.Permalink)
+	} else {
+		_, err = fmt.Fprintf(w, "#### %s (%s) ####\n%d points by %s | %d comments | %s\n\n",
+			story.Title, link, story.Score, story.By, story.Descendants, story.Permalink)
+	}
+	return err
+}
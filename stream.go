@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"unicode"
+)
+
+//Reports whether the JSON in r is an array, by peeking at its first non-whitespace byte without
+//consuming it. Anything else is taken to be one JSON object per line
+func startsWithArray(r *bufio.Reader) (bool, error) {
+	for {
+		b, err := r.Peek(1)
+		if err == io.EOF {
+			return false, errors.New("expected a JSON array or one JSON object per line, got an empty file")
+		} else if err != nil {
+			return false, err
+		}
+		if !unicode.IsSpace(rune(b[0])) {
+			return b[0] == '[', nil
+		}
+		r.ReadByte()
+	}
+}
+
+//Splits a JSON array of comments, or one comment per line, into comments one at a time and decodes
+//and filters them on workers goroutines while the rest of the file is still being read. Each
+//comment is scanned twice, so this only beats decoding the whole file before filtering it with
+//several cores, see BenchmarkFilterFromFile. Returns the comments that pass filter in the order
+//they appear in r
+func filterFromFileStreaming(r io.Reader, filter filterFunction, workers int) ([]hnComment, error) {
+	reader := bufio.NewReader(r)
+	array, err := startsWithArray(reader)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(reader)
+	if array {
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	type job struct {
+		index int
+		raw   json.RawMessage
+	}
+	jobs := make(chan job, workers)
+	var mu sync.Mutex
+	kept := make(map[int]hnComment)
+	var decodeErr error
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				var c hnComment
+				err := json.Unmarshal(j.raw, &c)
+				keep := err == nil && filter(&c)
+				mu.Lock()
+				if err != nil && decodeErr == nil {
+					decodeErr = fmt.Errorf("comment %d: %v", j.index, err)
+				} else if keep {
+					kept[j.index] = c
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	n := 0
+	for decoder.More() {
+		var raw json.RawMessage
+		if err = decoder.Decode(&raw); err != nil {
+			break
+		}
+		jobs <- job{index: n, raw: raw}
+		n++
+	}
+	close(jobs)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	comments := make([]hnComment, 0, len(kept))
+	for i := 0; i < n; i++ {
+		if c, ok := kept[i]; ok {
+			comments = append(comments, c)
+		}
+	}
+	return comments, nil
+}
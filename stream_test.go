@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+//Returns a JSON array of n comments shaped like Who's Hiring postings, one in four mentioning golang
+func archive(n int) []byte {
+	comments := make([]hnComment, n)
+	for i := range comments {
+		stack := "Python, Postgres"
+		if i%4 == 0 {
+			stack = "Golang, Kubernetes"
+		}
+		comments[i] = hnComment{
+			By:     fmt.Sprintf("user%d", i),
+			ID:     int64(38490000 + i),
+			Parent: 38480000,
+			Text: fmt.Sprintf("Company %d | Senior Engineer | %s | REMOTE | $150k<p>%s<p>Email jobs@company%d.com",
+				i, stack, strings.Repeat("We are building tools for teams. ", 20), i),
+		}
+	}
+	b, _ := json.Marshal(comments)
+	return b
+}
+
+//Decodes the whole file and then filters it, like -inFile without -decodeWorkers
+func filterFromFileSimple(b []byte, filter filterFunction) ([]hnComment, error) {
+	comments, err := fetchFromFile(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	var kept []hnComment
+	for i := range comments {
+		if filter(&comments[i]) {
+			kept = append(kept, comments[i])
+		}
+	}
+	return kept, nil
+}
+
+var golangFilter = filterTextFromKeywords([]string{"golang"}, keywordOptions{minMatches: 1})
+
+func TestFilterFromFileStreaming(t *testing.T) {
+	b := archive(1000)
+	want, err := filterFromFileSimple(b, golangFilter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{1, 4} {
+		got, err := filterFromFileStreaming(bytes.NewReader(b), golangFilter, workers)
+		if err != nil {
+			t.Fatalf("%d workers: %v", workers, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d workers kept %d comments, want the %d in file order", workers, len(got), len(want))
+		}
+	}
+
+	if _, err := filterFromFileStreaming(bytes.NewReader(b[:len(b)/2]), golangFilter, 4); err == nil {
+		t.Error("filterFromFileStreaming of a truncated array didn't fail")
+	}
+}
+
+func BenchmarkFilterFromFile(b *testing.B) {
+	file := archive(20000)
+	b.Run("simple", func(b *testing.B) {
+		b.SetBytes(int64(len(file)))
+		for i := 0; i < b.N; i++ {
+			if _, err := filterFromFileSimple(file, golangFilter); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	workerCounts := []int{1, 4}
+	if cpus := runtime.NumCPU(); cpus != 1 && cpus != 4 {
+		workerCounts = append(workerCounts, cpus)
+	}
+	for _, workers := range workerCounts {
+		b.Run(fmt.Sprintf("streaming-%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(file)))
+			for i := 0; i < b.N; i++ {
+				if _, err := filterFromFileStreaming(bytes.NewReader(file), golangFilter, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
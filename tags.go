@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+//The tags extracted from a comment when no -tagsFile is given. Same format as a tags file
+const defaultTagDictionary = `
+go: golang, go lang
+rust
+python
+javascript: javascript, js
+typescript
+java
+kotlin
+swift
+ruby
+rails: rails, ruby on rails
+php
+c++
+c#
+elixir
+erlang
+haskell
+scala
+clojure
+react
+vue
+angular
+node: node, node.js, nodejs
+django
+postgres: postgres, postgresql
+mysql
+kubernetes: kubernetes, k8s
+docker
+aws
+gcp
+azure
+terraform
+machine learning: machine learning, ml
+`
+
+//A tag and the phrasings that mention it
+type tagRule struct {
+	tag     string
+	pattern *regexp.Regexp
+}
+
+//Parses a tag dictionary: one tag per line, optionally followed by a colon and comma-separated
+//aliases that are matched instead of the tag itself. Lines starting with # are comments
+func parseTagDictionary(r io.Reader) ([]tagRule, error) {
+	var rules []tagRule
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tag, aliasList := line, line
+		if i := strings.Index(line, ":"); i != -1 {
+			tag, aliasList = strings.TrimSpace(line[:i]), line[i+1:]
+		}
+
+		var alternatives []string
+		for _, alias := range strings.Split(aliasList, ",") {
+			if alias = strings.TrimSpace(alias); alias != "" {
+				alternatives = append(alternatives, regexp.QuoteMeta(alias))
+			}
+		}
+		if tag == "" || len(alternatives) == 0 {
+			continue
+		}
+		//Word boundaries that also work for names like c++, c# and node.js. A preceding dot is
+		//part of the word so js doesn't match in node.js
+		pattern := `(?i)(?:^|[^\w+#.])(?:` + strings.Join(alternatives, "|") + `)(?:$|[^\w+#])`
+		rules = append(rules, tagRule{tag: strings.ToLower(tag), pattern: regexp.MustCompile(pattern)})
+	}
+	return rules, scanner.Err()
+}
+
+//Returns the tag dictionary in filename, or the built-in dictionary if filename is empty. A file
+//that can't be read is logged and the built-in dictionary is used instead, so a missing config
+//file doesn't fail a scheduled run
+func loadTagDictionary(filename string) []tagRule {
+	defaults, err := parseTagDictionary(strings.NewReader(defaultTagDictionary))
+	fatalnWrapper(err)
+	if filename == "" {
+		return defaults
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		log.Printf("Warning: using the built-in tags, can't read tags file: %v", err)
+		return defaults
+	}
+	defer file.Close()
+
+	rules, err := parseTagDictionary(file)
+	if err != nil {
+		log.Printf("Warning: using the built-in tags, can't read tags file %s: %v", filename, err)
+		return defaults
+	}
+	return rules
+}
+
+//Returns the tags whose phrasings occur in text, in dictionary order
+func extractTags(text string, rules []tagRule) []string {
+	text = stripHTML(text, linkText)
+	var tags []string
+	for _, rule := range rules {
+		if rule.pattern.MatchString(text) {
+			tags = append(tags, rule.tag)
+		}
+	}
+	return tags
+}
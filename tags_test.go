@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//Returns the tags of rules
+func ruleTags(rules []tagRule) []string {
+	var tags []string
+	for _, rule := range rules {
+		tags = append(tags, rule.tag)
+	}
+	return tags
+}
+
+func TestLoadTagDictionary(t *testing.T) {
+	defaults := ruleTags(loadTagDictionary(""))
+	if len(defaults) == 0 {
+		t.Fatal("the built-in dictionary has no tags")
+	}
+
+	filename := filepath.Join(t.TempDir(), "tags.txt")
+	if err := ioutil.WriteFile(filename, []byte("# Languages\nGo: golang\nrust\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if tags := ruleTags(loadTagDictionary(filename)); !reflect.DeepEqual(tags, []string{"go", "rust"}) {
+		t.Errorf("loaded tags %v from %s, want [go rust]", tags, filename)
+	}
+
+	//A missing file falls back to the built-in dictionary instead of failing
+	missing := filepath.Join(t.TempDir(), "missing.txt")
+	if tags := ruleTags(loadTagDictionary(missing)); !reflect.DeepEqual(tags, defaults) {
+		t.Errorf("loaded tags %v for a missing file, want the built-in ones", tags)
+	}
+}
+
+func TestExtractTags(t *testing.T) {
+	rules := loadTagDictionary("")
+	tests := []struct {
+		text string
+		tags []string
+	}{
+		{"Acme | Golang, Python, Postgres | REMOTE", []string{"go", "python", "postgres"}},
+		{"We use node.js and C++ on k8s", []string{"c++", "node", "kubernetes"}},
+		{"Onboarding is quick, you'll be ready to go in a week", nil},
+		{"<p>Stack: <i>Rust</i>", []string{"rust"}},
+	}
+	for _, test := range tests {
+		if tags := extractTags(test.text, rules); !reflect.DeepEqual(tags, test.tags) {
+			t.Errorf("extractTags(%q) = %v, want %v", test.text, tags, test.tags)
+		}
+	}
+}
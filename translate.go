@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+//Translates comments through a LibreTranslate compatible API: the text is POSTed as
+//{"q", "source", "target", "format", "api_key"} and the response is {"translatedText"}.
+//Translations are cached per comment ID and target language so each comment is only sent once
+type translator struct {
+	url      string
+	key      string
+	target   string
+	cacheDir string
+}
+
+type translateRequest struct {
+	Q      string `json:"q"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Format string `json:"format"`
+	APIKey string `json:"api_key,omitempty"`
+}
+
+type translateResponse struct {
+	TranslatedText string `json:"translatedText"`
+	Error          string `json:"error"`
+}
+
+//Sets the Translation field of every comment. Comments that fail to translate are logged and
+//keep an empty Translation, their Text is never modified
+func (t *translator) translateAll(ctx context.Context, comments []hnComment) {
+	for i := range comments {
+		if ctx.Err() != nil {
+			return
+		}
+		translation, err := t.translate(ctx, comments[i].ID, comments[i].Text)
+		if err != nil {
+			log.Printf("Not translating comment %d: %v", comments[i].ID, err)
+			continue
+		}
+		comments[i].Translation = translation
+	}
+}
+
+func (t *translator) translate(ctx context.Context, id int64, text string) (string, error) {
+	cachedFileName := filepath.Join(t.cacheDir, t.target, fmt.Sprintf("%d.json", id))
+	if cached, err := ioutil.ReadFile(cachedFileName); err == nil {
+		var translation string
+		if err := json.Unmarshal(cached, &translation); err == nil {
+			return translation, nil
+		}
+	}
+
+	body, err := json.Marshal(translateRequest{Q: text, Source: "auto", Target: t.target, Format: "html", APIKey: t.key})
+	if err != nil {
+		return "", err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	var translated translateResponse
+	if err := json.NewDecoder(response.Body).Decode(&translated); err != nil {
+		return "", fmt.Errorf("decoding translation: %v", err)
+	}
+	if response.StatusCode != http.StatusOK || translated.Error != "" {
+		return "", fmt.Errorf("translation API responded %s: %s", response.Status, translated.Error)
+	}
+
+	if cached, err := json.Marshal(translated.TranslatedText); err == nil {
+		if err := os.MkdirAll(filepath.Dir(cachedFileName), 0777); err == nil {
+			err = ioutil.WriteFile(cachedFileName, cached, 0666)
+		}
+		if err != nil {
+			log.Println("Not caching translation:", err)
+		}
+	}
+	return translated.TranslatedText, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+//A comment and the fetched replies to it
+type commentNode struct {
+	hnComment
+	Depth   int            `json:"depth"`
+	Replies []*commentNode `json:"replies,omitempty"`
+}
+
+//Rebuilds the reply tree of a flat comment list from the Parent fields. Comments whose parent
+//isn't in the list, such as top-level comments whose parent is the story, become roots at depth 0.
+//Siblings keep their order in comments. Works on any flat list, including caches that were
+//written before replies were fetched
+func buildTree(comments []hnComment) []*commentNode {
+	nodes := make(map[int64]*commentNode, len(comments))
+	for _, c := range comments {
+		if _, ok := nodes[c.ID]; !ok {
+			nodes[c.ID] = &commentNode{hnComment: c}
+		}
+	}
+
+	var roots []*commentNode
+	placed := make(map[int64]bool, len(nodes))
+	for _, c := range comments {
+		if placed[c.ID] {
+			continue
+		}
+		placed[c.ID] = true
+		node := nodes[c.ID]
+		if parent, ok := nodes[c.Parent]; ok && parent != node {
+			parent.Replies = append(parent.Replies, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	visited := make(map[int64]bool, len(nodes))
+	for _, root := range roots {
+		setDepth(root, 0, visited)
+	}
+
+	//Comments that weren't reached from a root have a cycle in their parents, which the API
+	//shouldn't return but a hand edited file could contain. Promote them to roots to break it
+	for _, c := range comments {
+		if !visited[c.ID] {
+			node := nodes[c.ID]
+			for _, n := range nodes {
+				n.Replies = removeNode(n.Replies, node)
+			}
+			roots = append(roots, node)
+			setDepth(node, 0, visited)
+		}
+	}
+	return roots
+}
+
+func setDepth(node *commentNode, depth int, visited map[int64]bool) {
+	if visited[node.ID] {
+		return
+	}
+	visited[node.ID] = true
+	node.Depth = depth
+	for _, reply := range node.Replies {
+		setDepth(reply, depth+1, visited)
+	}
+}
+
+func removeNode(nodes []*commentNode, node *commentNode) []*commentNode {
+	for i, n := range nodes {
+		if n == node {
+			return append(nodes[:i], nodes[i+1:]...)
+		}
+	}
+	return nodes
+}
+
+//Sets the ReplyCount of every comment to the number of comments in the list that reply to it
+func countReplies(comments []hnComment) {
+	counts := make(map[int64]int, len(comments))
+	for _, c := range comments {
+		counts[c.Parent]++
+	}
+	for i := range comments {
+		count := counts[comments[i].ID]
+		comments[i].ReplyCount = &count
+	}
+}
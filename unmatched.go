@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+//The comments that passed the filter and the ones that didn't, for -showUnmatched
+type matchSections struct {
+	Matched   []hnComment `json:"matched"`
+	Unmatched []hnComment `json:"unmatched"`
+}
+
+func validateShowUnmatched(format string) error {
+	switch format {
+	case formatJSON, formatBlob, formatMarkdown:
+		return nil
+	}
+	return fmt.Errorf("-showUnmatched supports -format json, blob or markdown, not %q", format)
+}
+
+//Writes the matched and the unmatched comments as two labeled sections, a JSON object with matched
+//and unmatched arrays or a blob or markdown heading above each
+func writeSections(w io.Writer, sections matchSections, options outputOptions) error {
+	switch options.format {
+	case formatBlob, formatMarkdown:
+		heading := "######## %s (%d) ########\n\n"
+		if options.format == formatMarkdown {
+			heading = "# %s (%d)\n\n"
+		}
+		for _, section := range []struct {
+			label    string
+			comments []hnComment
+		}{{"Matched", sections.Matched}, {"Unmatched", sections.Unmatched}} {
+			if _, err := fmt.Fprintf(w, heading, section.label, len(section.comments)); err != nil {
+				return err
+			}
+			var err error
+			if options.format == formatMarkdown {
+				err = writeMarkdown(w, section.comments, false, options.linkStyle)
+			} else {
+				err = writeBlob(w, section.comments, options.color, options.linkStyle)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		//Encode empty sections as [] rather than null
+		if sections.Matched == nil {
+			sections.Matched = []hnComment{}
+		}
+		if sections.Unmatched == nil {
+			sections.Unmatched = []hnComment{}
+		}
+		var output interface{} = sections
+		if options.noParent {
+			output = map[string]interface{}{
+				"matched":   withoutParents(sections.Matched),
+				"unmatched": withoutParents(sections.Unmatched),
+			}
+		}
+		if options.rootKey != "" {
+			output = map[string]interface{}{options.rootKey: output}
+		}
+		return json.NewEncoder(w).Encode(output)
+	}
+}
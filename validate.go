@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+//Checks the comments in a cache or output file, writing a line to w for every problem found and a
+//summary at the end. Every comment needs an ID and, unless it's deleted, an author and text, and
+//IDs have to be unique. Returns the number of problems
+func validateCommentsFile(w io.Writer, filename string) (int, error) {
+	comments, err := readCommentsFile(filename)
+	if err != nil {
+		return 0, fmt.Errorf("%s can't be decoded: %v", filename, err)
+	}
+
+	problems := 0
+	report := func(i int, format string, args ...interface{}) {
+		problems++
+		fmt.Fprintf(w, "%s: comment #%d: %s\n", filename, i+1, fmt.Sprintf(format, args...))
+	}
+	first := make(map[string]int)
+	for i, c := range comments {
+		if c.ID == 0 {
+			report(i, "missing id")
+			continue
+		}
+		if !c.Deleted && c.By == "" {
+			report(i, "%d has no author", c.ID)
+		}
+		if !c.Deleted && c.Text == "" {
+			report(i, "%d has no text", c.ID)
+		}
+		key := dedupeKey(c, dedupeByID)
+		if j, ok := first[key]; ok {
+			report(i, "%d is a duplicate of comment #%d", c.ID, j+1)
+		} else {
+			first[key] = i
+		}
+	}
+	_, err = fmt.Fprintf(w, "%s: %d comments, %d problems\n", filename, len(comments), problems)
+	return problems, err
+}
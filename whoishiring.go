@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+//The account that posts the monthly Who is hiring threads, along with Who wants to be hired and
+//Freelancer threads
+const whoIsHiringUser = "whoishiring"
+
+const whoIsHiringTitlePrefix = "Ask HN: Who is hiring?"
+
+type hnUser struct {
+	ID    string `json:"id"`
+	Karma int    `json:"karma"`
+	//The user's stories and comments, newest first
+	Submitted []int64 `json:"submitted"`
+}
+
+//Returns the IDs of the last n Who is hiring threads, newest first. Fewer are returned if the
+//whoishiring account hasn't posted that many
+func lastHiringThreads(ctx context.Context, n int) ([]int64, error) {
+	var user hnUser
+	if _, err := fetchObject(ctx, fmt.Sprintf("%s/user/%s.json", apiBase, whoIsHiringUser), &user); err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for _, id := range user.Submitted {
+		if len(ids) == n {
+			break
+		}
+		thread, err := getThreadFromAPI(ctx, itemURL(id))
+		if err != nil {
+			log.Printf("Skipping whoishiring submission %d: %v", id, err)
+			continue
+		}
+		if strings.HasPrefix(thread.Title, whoIsHiringTitlePrefix) {
+			log.Printf("Found %q (%d)", thread.Title, id)
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
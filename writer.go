@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+//How the output file is opened and what's written to it
+type writerOptions struct {
+	//The file to write to, stdout if empty
+	filename string
+	format   string
+	//Compress the output with gzip
+	gzip bool
+	//Add to the end of filename instead of replacing it. JSON can't be appended to and is merged
+	//into the existing array with appendJSON instead
+	append bool
+	//Wrap JSON output in an object under this key, see outputOptions
+	rootKey string
+	//Comments are nested in the output, with -tree or -group-by
+	nested bool
+}
+
+//Reports combinations of options that would produce a corrupt or unreadable file. ndjson can be
+//appended to as is. A JSON array is merged with the comments already in the file, which only works
+//for a plain uncompressed array, and a second report or blob after the first isn't valid anymore.
+//Appended gzip output is fine as concatenated gzip streams decompress as one
+func (o writerOptions) validate() error {
+	if err := validateFormat(o.format); err != nil {
+		return err
+	}
+	if o.append && o.filename == "" {
+		return errors.New("-append requires -outFile")
+	}
+	if o.append && o.format != formatNDJSON && o.format != formatJSON {
+		return fmt.Errorf("-append requires -format ndjson or json, appending %s output would corrupt the file", o.format)
+	}
+	if o.append && o.format == formatJSON && (o.gzip || o.rootKey != "" || o.nested) {
+		return errors.New("-append with -format json merges into a plain array of comments and can't be " +
+			"combined with -gzip, -root object, -tree or -group-by, use -format ndjson instead")
+	}
+	if o.rootKey != "" && o.format == formatNDJSON {
+		return errors.New("-root object can't be used with -format ndjson, every line is already an object")
+	}
+	return nil
+}
+
+//The destination of the output. Writes are buffered until Flush or Close, closing it flushes the
+//buffer and the compression and closes the file
+type outputWriter struct {
+	*bufio.Writer
+	file       *os.File
+	compressor *gzip.Writer
+}
+
+//Validates options and opens the file output is written to, stdout if options.filename is empty
+func newOutputWriter(options writerOptions) (*outputWriter, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	if options.append && options.format != formatNDJSON {
+		return nil, fmt.Errorf("can't append %s output to %s", options.format, options.filename)
+	}
+
+	w := &outputWriter{file: os.Stdout}
+	if options.filename == "" {
+		log.Println("No outfile specified, defaulting to stdout")
+	} else {
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if options.append {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+			if !options.gzip {
+				if err := trimPartialLine(options.filename); err != nil {
+					return nil, err
+				}
+			}
+		}
+		file, err := os.OpenFile(options.filename, flags, 0666)
+		if err != nil {
+			return nil, err
+		}
+		w.file = file
+	}
+
+	var dest io.Writer = w.file
+	if options.gzip {
+		w.compressor = gzip.NewWriter(w.file)
+		dest = w.compressor
+	}
+	w.Writer = bufio.NewWriter(dest)
+	return w, nil
+}
+
+//Removes an incomplete last line from the ndjson file filename, left by a run that was killed while
+//writing it, so lines appended after it stay parseable. A missing file is fine
+func trimPartialLine(filename string) error {
+	file, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	//Read backwards from the end in chunks until the last newline
+	end := info.Size()
+	chunk := make([]byte, 4096)
+	for offset := end; offset > 0; {
+		n := int64(len(chunk))
+		if offset < n {
+			n = offset
+		}
+		offset -= n
+		if _, err := file.ReadAt(chunk[:n], offset); err != nil {
+			return err
+		}
+		if i := bytes.LastIndexByte(chunk[:n], '\n'); i != -1 {
+			end = offset + int64(i) + 1
+			break
+		}
+		if offset == 0 {
+			end = 0
+		}
+	}
+	if end == info.Size() {
+		return nil
+	}
+	log.Printf("Removing the incomplete last line of %s, %d bytes", filename, info.Size()-end)
+	return file.Truncate(end)
+}
+
+//Writes records to an output from any number of goroutines. A single goroutine owns the output
+//and writes and flushes each record whole before taking the next, so records never interleave and
+//a crash leaves at most the last record partially written, which trimPartialLine removes on the
+//next append. Every Write is one record, like a line from json.Encoder.Encode
+type recordWriter struct {
+	records chan []byte
+	done    chan struct{}
+	//The first error writing or flushing, after which records are dropped
+	err error
+}
+
+//Starts the goroutine writing records to w. w is flushed after every record if it's a flusher
+func newRecordWriter(w io.Writer) *recordWriter {
+	r := &recordWriter{records: make(chan []byte), done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		for record := range r.records {
+			if r.err != nil {
+				continue
+			}
+			if _, err := w.Write(record); err != nil {
+				r.err = err
+			} else if f, ok := w.(flusher); ok {
+				r.err = f.Flush()
+			}
+		}
+	}()
+	return r
+}
+
+//Queues a copy of p as one record. Errors are reported by Close
+func (r *recordWriter) Write(p []byte) (int, error) {
+	r.records <- append([]byte(nil), p...)
+	return len(p), nil
+}
+
+//Waits for the queued records to be written and returns the first error. Write can't be called
+//after Close
+func (r *recordWriter) Close() error {
+	close(r.records)
+	<-r.done
+	return r.err
+}
+
+//Reports whether text written to w should be colored, never when it's compressed
+func (w *outputWriter) color(noColor bool) bool {
+	return w.compressor == nil && colorEnabled(w.file, noColor)
+}
+
+//Writes out the buffered output, through the compression if there is any
+func (w *outputWriter) Flush() error {
+	if err := w.Writer.Flush(); err != nil {
+		return err
+	}
+	if w.compressor != nil {
+		return w.compressor.Flush()
+	}
+	return nil
+}
+
+func (w *outputWriter) Close() error {
+	if err := w.Writer.Flush(); err != nil {
+		if w.file != os.Stdout {
+			w.file.Close()
+		}
+		return err
+	}
+	if w.compressor != nil {
+		if err := w.compressor.Close(); err != nil {
+			w.file.Close()
+			return err
+		}
+	}
+	if w.file == os.Stdout {
+		return nil
+	}
+	return w.file.Close()
+}
+
+//Merges comments into the JSON array in filename, replacing comments with the same ID, and
+//replaces the file with the result. A missing file is created. Returns the number of comments
+//in the file afterwards
+func appendJSON(filename string, comments []hnComment) (int, error) {
+	var existing []hnComment
+	if fileExists(filename) {
+		var err error
+		if existing, err = readCommentsFile(filename); err != nil {
+			return 0, fmt.Errorf("can't append to %s: %v", filename, err)
+		}
+	}
+	merged := mergeComments(existing, comments)
+	return len(merged), writeJSONAtomic(filename, merged)
+}
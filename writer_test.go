@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriterOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options writerOptions
+		valid   bool
+	}{
+		{"json", writerOptions{format: formatJSON}, true},
+		{"json gzip", writerOptions{filename: "out.json.gz", format: formatJSON, gzip: true}, true},
+		{"json root", writerOptions{format: formatJSON, rootKey: "comments"}, true},
+		{"json gzip root", writerOptions{format: formatJSON, gzip: true, rootKey: "comments"}, true},
+		{"json append", writerOptions{filename: "out.json", format: formatJSON, append: true}, true},
+		{"ndjson", writerOptions{format: formatNDJSON}, true},
+		{"ndjson gzip", writerOptions{format: formatNDJSON, gzip: true}, true},
+		{"ndjson append", writerOptions{filename: "out.ndjson", format: formatNDJSON, append: true}, true},
+		{"ndjson gzip append", writerOptions{filename: "out.ndjson.gz", format: formatNDJSON, gzip: true, append: true}, true},
+		{"markdown gzip", writerOptions{format: formatMarkdown, gzip: true}, true},
+
+		{"unknown format", writerOptions{format: "yaml"}, false},
+		{"append to stdout", writerOptions{format: formatNDJSON, append: true}, false},
+		{"markdown append", writerOptions{filename: "out.md", format: formatMarkdown, append: true}, false},
+		{"blob append", writerOptions{filename: "out.txt", format: formatBlob, append: true}, false},
+		{"json gzip append", writerOptions{filename: "out.json.gz", format: formatJSON, gzip: true, append: true}, false},
+		{"json root append", writerOptions{filename: "out.json", format: formatJSON, rootKey: "c", append: true}, false},
+		{"json tree append", writerOptions{filename: "out.json", format: formatJSON, nested: true, append: true}, false},
+		{"ndjson root", writerOptions{format: formatNDJSON, rootKey: "comments"}, false},
+	}
+	for _, test := range tests {
+		err := test.options.validate()
+		if test.valid && err != nil {
+			t.Errorf("%s: validate failed: %v", test.name, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%s: validate passed, want an error", test.name)
+		}
+	}
+}
+
+//Reads filename, decompressing it if compressed is set
+func readOutput(t *testing.T, filename string, compressed bool) string {
+	t.Helper()
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if compressed {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gz
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestNewOutputWriter(t *testing.T) {
+	comments := []hnComment{{By: "alice", ID: 1, Parent: 100}, {By: "bob", ID: 2, Parent: 100}}
+	tests := []struct {
+		name    string
+		options writerOptions
+		//What the file holds after writing comments twice, decompressed
+		want string
+	}{
+		{"json", writerOptions{format: formatJSON},
+			`[{"by":"alice","id":1,"parent":100,"text":""},{"by":"bob","id":2,"parent":100,"text":""}]` + "\n"},
+		{"json gzip", writerOptions{format: formatJSON, gzip: true},
+			`[{"by":"alice","id":1,"parent":100,"text":""},{"by":"bob","id":2,"parent":100,"text":""}]` + "\n"},
+		{"json root", writerOptions{format: formatJSON, rootKey: "comments"},
+			`{"comments":[{"by":"alice","id":1,"parent":100,"text":""},{"by":"bob","id":2,"parent":100,"text":""}]}` + "\n"},
+		{"ndjson", writerOptions{format: formatNDJSON},
+			`{"by":"alice","id":1,"parent":100,"text":""}` + "\n" + `{"by":"bob","id":2,"parent":100,"text":""}` + "\n"},
+		{"ndjson gzip", writerOptions{format: formatNDJSON, gzip: true},
+			`{"by":"alice","id":1,"parent":100,"text":""}` + "\n" + `{"by":"bob","id":2,"parent":100,"text":""}` + "\n"},
+		{"ndjson append", writerOptions{format: formatNDJSON, append: true},
+			strings.Repeat(`{"by":"alice","id":1,"parent":100,"text":""}`+"\n"+`{"by":"bob","id":2,"parent":100,"text":""}`+"\n", 2)},
+		//Concatenated gzip streams decompress as one
+		{"ndjson gzip append", writerOptions{format: formatNDJSON, gzip: true, append: true},
+			strings.Repeat(`{"by":"alice","id":1,"parent":100,"text":""}`+"\n"+`{"by":"bob","id":2,"parent":100,"text":""}`+"\n", 2)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.options.filename = filepath.Join(t.TempDir(), "out")
+			for i := 0; i < 2; i++ {
+				w, err := newOutputWriter(test.options)
+				if err != nil {
+					t.Fatalf("newOutputWriter failed: %v", err)
+				}
+				options := outputOptions{format: test.options.format, rootKey: test.options.rootKey}
+				if err := writeComments(w, comments, options); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := readOutput(t, test.options.filename, test.options.gzip); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewOutputWriterRejectsInvalidOptions(t *testing.T) {
+	options := writerOptions{filename: filepath.Join(t.TempDir(), "out"), format: formatMarkdown, append: true}
+	if _, err := newOutputWriter(options); err == nil {
+		t.Error("newOutputWriter appended markdown")
+	}
+}
+
+func TestTrimPartialLine(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "out.ndjson")
+	if err := ioutil.WriteFile(filename, []byte("{\"id\":1}\n{\"id\":2}\n{\"id\":"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := trimPartialLine(filename); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var c hnComment
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		ids = append(ids, c.ID)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 2}) {
+		t.Errorf("got IDs %v, want [1 2]", ids)
+	}
+}
+
+//Writes every record in two halves, yielding in between so concurrent writers would interleave,
+//and counts flushes
+type slowWriter struct {
+	bytes.Buffer
+	flushes int
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	half := len(p) / 2
+	w.Buffer.Write(p[:half])
+	runtime.Gosched()
+	w.Buffer.Write(p[half:])
+	return len(p), nil
+}
+
+func (w *slowWriter) Flush() error {
+	w.flushes++
+	return nil
+}
+
+func TestRecordWriterInterleavedWrites(t *testing.T) {
+	const writers, perWriter = 8, 100
+	out := &slowWriter{}
+	records := newRecordWriter(out)
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			encoder := json.NewEncoder(records)
+			for j := 0; j < perWriter; j++ {
+				c := hnComment{By: fmt.Sprintf("writer%d", i), ID: int64(i*perWriter + j), Text: strings.Repeat("x", j)}
+				if err := encoder.Encode(c); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := records.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int
+	scanner := bufio.NewScanner(&out.Buffer)
+	for scanner.Scan() {
+		var c hnComment
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			t.Fatalf("line %q is corrupt: %v", scanner.Text(), err)
+		}
+		ids = append(ids, int(c.ID))
+	}
+	sort.Ints(ids)
+	for i, id := range ids {
+		if id != i {
+			t.Fatalf("got IDs %v, want 0 to %d once each", ids, writers*perWriter-1)
+		}
+	}
+	if len(ids) != writers*perWriter || out.flushes != writers*perWriter {
+		t.Errorf("got %d records and %d flushes, want %d of each", len(ids), out.flushes, writers*perWriter)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestRecordWriterReportsErrors(t *testing.T) {
+	records := newRecordWriter(failingWriter{})
+	fmt.Fprintln(records, `{"id":1}`)
+	fmt.Fprintln(records, `{"id":2}`)
+	if err := records.Close(); err == nil || err.Error() != "disk full" {
+		t.Errorf("Close returned %v, want the write error", err)
+	}
+}